@@ -0,0 +1,84 @@
+package check
+
+import (
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+)
+
+// replaceSubtitle hands a bad subtitle to the first Bazarr that manages it, which deletes it and downloads that
+// language again. It reports whether a Bazarr took the file.
+func (c *Checkrr) replaceSubtitle(file *FileContext, verdict Verdict) bool {
+	for _, bazarr := range c.bazarr {
+		if !bazarr.Process || !file.Profile.usesArr(bazarr.Name) || !bazarr.MatchPath(file.Path) {
+			continue
+		}
+		if c.dryRun {
+			c.recordBadFile(file.Path, "bazarr", verdict)
+			return true
+		}
+		if !bazarr.RemoveFile(file.Path) {
+			continue
+		}
+		title := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "NotificationsReacquireTitle",
+		})
+		desc := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "NotificationsReacquireDesc",
+			TemplateData: map[string]interface{}{
+				"Path":    file.Path,
+				"Service": "bazarr",
+			},
+		})
+		c.notifications.Notify(title, desc, "reacquire", file.Path)
+		c.recordBadFile(file.Path, "bazarr", verdict)
+		return true
+	}
+	return false
+}
+
+// bazarrManages reports whether a Bazarr checkrr can use manages a file
+func (c *Checkrr) bazarrManages(file *FileContext) bool {
+	for _, bazarr := range c.bazarr {
+		if bazarr.Process && file.Profile.usesArr(bazarr.Name) && bazarr.MatchPath(file.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// subtitleLanguage handles removelang matching only subtitle streams of a video that a Bazarr manages. The video is
+// fine, so rather than reacquiring it Bazarr is asked to search for subtitles. If it won't, the file is flagged.
+// Files no Bazarr manages are reacquired like any other removelang match.
+func (c *Checkrr) subtitleLanguage(file *FileContext, streams []int) {
+	verdict := Verdict{Result: Fail, Check: "codecs", Reason: "subtitle lang", Details: map[string]interface{}{"streams": streams}}
+	if c.dryRun {
+		c.recordBadFile(file.Path, "bazarr", verdict)
+		return
+	}
+	if c.searchSubtitles(file) {
+		c.recordBadFile(file.Path, "bazarr", verdict)
+		return
+	}
+	c.recordBadFile(file.Path, "flagged", verdict)
+}
+
+// searchSubtitles asks Bazarr to look for the subtitles a video is missing, after removelang stripped subtitle
+// streams out of it or found them in the wrong language. It reports whether a Bazarr took the search.
+func (c *Checkrr) searchSubtitles(file *FileContext) bool {
+	for _, bazarr := range c.bazarr {
+		if !bazarr.Process || !file.Profile.usesArr(bazarr.Name) || !bazarr.MatchPath(file.Path) {
+			continue
+		}
+		if bazarr.SearchMissing(file.Path) {
+			message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "BazarrSubtitleSearch",
+				TemplateData: map[string]interface{}{
+					"Path": file.Path,
+				},
+			})
+			c.Logger.WithFields(log.Fields{"Service": bazarr.Name}).Info(message)
+			return true
+		}
+	}
+	return false
+}
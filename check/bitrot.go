@@ -0,0 +1,182 @@
+package check
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"time"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+	"lukechampine.com/blake3"
+)
+
+// setupFullHash reads the fullhash config. Full hashes are only re-verified during scheduled runs, each file once
+// every verifyevery runs (or verifypercent of the library per run), spread evenly across runs.
+func (c *Checkrr) setupFullHash() {
+	conf := c.config.Cut("fullhash")
+	c.hashAlgo = conf.String("algorithm")
+	if c.hashAlgo != "" && c.hashAlgo != "sha256" && c.hashAlgo != "blake3" {
+		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "CheckFullHashUnknown",
+			TemplateData: map[string]interface{}{
+				"Algorithm": c.hashAlgo,
+			},
+		})
+		c.Logger.WithFields(log.Fields{"startup": true}).Warn(message)
+		c.hashAlgo = ""
+	}
+
+	c.verifyEvery = conf.Int("verifyevery")
+	if percent := conf.Float64("verifypercent"); percent > 0 {
+		c.verifyEvery = int(math.Ceil(100 / math.Min(percent, 100)))
+	}
+	c.verifyRun = -1
+}
+
+// countRun bumps the scheduled run counter that decides which files are due for verification
+func (c *Checkrr) countRun(resumed bool) {
+	if c.hashAlgo == "" || c.verifyEvery <= 0 {
+		return
+	}
+	err := c.DB.Update(func(tx *bolt.Tx) error {
+		// the run counter lives with the checkpoint so a resumed run verifies the same files
+		b := tx.Bucket([]byte("Checkrr-checkpoint"))
+		var runs uint64
+		if v := b.Get([]byte("runs")); len(v) == 8 {
+			runs = binary.BigEndian.Uint64(v)
+		}
+		if !resumed {
+			runs++
+		}
+		c.verifyRun = int64(runs)
+		return b.Put([]byte("runs"), binary.BigEndian.AppendUint64(nil, runs))
+	})
+	if err != nil {
+		c.logCheckpointError(err)
+	}
+}
+
+// verifyDue reports whether an unchanged file should have its full hash checked this run
+func (c *Checkrr) verifyDue(path string) bool {
+	if c.hashAlgo == "" || c.verifyEvery <= 0 || c.verifyRun < 0 {
+		return false
+	}
+	slot := int64(crc32.ChecksumIEEE([]byte(path)) % uint32(c.verifyEvery))
+	return slot == c.verifyRun%int64(c.verifyEvery)
+}
+
+// verifyFullHash rereads an unchanged file in full and compares it to its recorded hash. Files without a hash yet,
+// or hashed with a different algorithm, just get one recorded.
+func (c *Checkrr) verifyFullHash(ctx context.Context, path string, record *FileRecord) {
+	sum, err := fullHash(ctx, c.hashAlgo, path)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "CheckErrorReading",
+			TemplateData: map[string]interface{}{
+				"Path":  path,
+				"Error": err.Error(),
+			},
+		})
+		c.Logger.WithFields(log.Fields{"Full Hash": c.hashAlgo}).Warn(message)
+		return
+	}
+
+	if record.FullHash != "" && record.HashAlgo == c.hashAlgo && record.FullHash != sum {
+		c.count(ctx, "HashMismatches")
+		c.reportBitRot(ctx, path, record, sum)
+		return
+	}
+
+	c.Logger.WithFields(log.Fields{"Hash Match": true, "Full Hash": c.hashAlgo}).Infof("\"%v\"", path)
+	c.count(ctx, "HashMatches")
+	record.FullHash = sum
+	record.HashAlgo = c.hashAlgo
+	record.Verified = time.Now().UTC().Unix()
+	err = c.putRecord(path, record)
+	if err != nil {
+		c.logRecordError(path, err)
+	}
+}
+
+// reportBitRot handles a file whose contents changed without its size or mtime changing
+func (c *Checkrr) reportBitRot(ctx context.Context, path string, record *FileRecord, sum string) {
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckBitRot",
+		TemplateData: map[string]interface{}{
+			"Path": path,
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Bit Rot": true, "Full Hash": c.hashAlgo}).Warn(message)
+
+	title := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "NotificationsBitRotTitle",
+	})
+	desc := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "NotificationsBitRotDesc",
+		TemplateData: map[string]interface{}{
+			"Path": path,
+		},
+	})
+	c.notifications.Notify(title, desc, "bitrot", path)
+
+	c.deleteFile(&FileContext{Ctx: ctx, Path: path, Root: c.rootFor(path), Profile: c.profileOf(path)}, Verdict{
+		Result: Fail,
+		Check:  "bitrot",
+		Reason: "bit rot",
+		Details: map[string]interface{}{
+			"algorithm": c.hashAlgo,
+			"expected":  record.FullHash,
+			"actual":    sum,
+			"verified":  record.Verified,
+		},
+	})
+}
+
+// fullHash hashes the whole file, stopping early if ctx is cancelled
+func fullHash(ctx context.Context, algo string, path string) (string, error) {
+	var h hash.Hash
+	switch algo {
+	case "sha256":
+		h = sha256.New()
+	case "blake3":
+		h = blake3.New(32, nil)
+	default:
+		return "", fmt.Errorf("unknown hash algorithm %s", algo)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(h, ctxReader{ctx: ctx, r: f})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
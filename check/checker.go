@@ -0,0 +1,147 @@
+package check
+
+import (
+	"context"
+	"sync"
+
+	"github.com/knadh/koanf/v2"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/vansante/go-ffprobe.v2"
+)
+
+// Result is the outcome of a single check stage
+type Result int
+
+const (
+	// Pass lets the file move on to the next stage
+	Pass Result = iota
+	// Fail marks the file as bad and hands it to deleteFile
+	Fail
+	// Inconclusive stops checking the file without marking it bad or recording a hash, so it is looked at again
+	// on the next run
+	Inconclusive
+)
+
+// FileContext is everything the check stages know about the file being checked. Stages can add to it for the
+// stages that follow, the ffprobe stage fills in Probe for example.
+type FileContext struct {
+	Ctx    context.Context
+	Path   string
+	Root   string
+	Type   string
+	Header []byte
+	Probe  *ffprobe.ProbeData
+	// Profile is the settings of the checkpath the file is under
+	Profile *PathProfile
+	// Verifying is set while a repaired copy is checked before it replaces the file. Stages only judge it, they
+	// don't keep any state about it.
+	Verifying bool
+}
+
+// Verdict is what a check stage decided about a file
+type Verdict struct {
+	Result  Result
+	Check   string
+	Reason  string
+	Details map[string]interface{}
+	// Action overrides the configured action for a failed file, reacquire or quarantine
+	Action string
+}
+
+// Checker is a single validation stage. Checkers are shared between check workers, so Check must be safe to call
+// concurrently.
+type Checker interface {
+	Name() string
+	Check(file *FileContext) Verdict
+}
+
+// CheckerFactory builds a Checker for a run. It is called after the checkrr config has been read, so factories can
+// use the fields on Checkrr or pull their own settings from FullConfig.
+type CheckerFactory func(c *Checkrr) Checker
+
+var checkerFactories = map[string]CheckerFactory{}
+var checkerFactoriesLock sync.Mutex
+
+// RegisterChecker makes a check stage available by name to the checks and pathchecks config options. Registering
+// a name twice replaces the earlier factory.
+func RegisterChecker(name string, factory CheckerFactory) {
+	checkerFactoriesLock.Lock()
+	defer checkerFactoriesLock.Unlock()
+	checkerFactories[name] = factory
+}
+
+// defaultChecks builds the stage order from the ffprobe, requireaudio, rules, mindurationpercent, checksums,
+// containercheck and ffmpeg flags of a checkpath's settings, for configs without a checks list.
+func (c *Checkrr) defaultChecks(conf *koanf.Koanf) []string {
+	var checks []string
+	if conf.Bool("ffprobe") {
+		checks = append(checks, "ffprobe")
+		if conf.Bool("requireaudio") {
+			checks = append(checks, "requireaudio")
+		}
+		checks = append(checks, "codecs")
+		if len(conf.Slices("rules")) > 0 {
+			checks = append(checks, "rules")
+		}
+		if conf.Float64("mindurationpercent") > 0 {
+			checks = append(checks, "duration")
+		}
+	}
+	if conf.Bool("checksums") {
+		checks = append(checks, "checksums")
+	}
+	// after checksums, sidecar files list the name the file had before a rename
+	if conf.Bool("containercheck") {
+		checks = append(checks, "container")
+	}
+	if conf.Bool("ffmpeg-quick") {
+		checks = append(checks, "ffmpeg-quick")
+	}
+	if conf.Bool("ffmpeg-full") {
+		checks = append(checks, "ffmpeg-full")
+	}
+	return checks
+}
+
+// buildCheckers turns a list of stage names into checkers, skipping any name that isn't registered or a script
+func (c *Checkrr) buildCheckers(names []string) []Checker {
+	checkerFactoriesLock.Lock()
+	defer checkerFactoriesLock.Unlock()
+
+	var checkers []Checker
+	for _, name := range names {
+		factory, ok := checkerFactories[name]
+		if !ok {
+			factory, ok = c.scripts[name]
+		}
+		if !ok {
+			message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "CheckUnknownChecker",
+				TemplateData: map[string]interface{}{
+					"Name": name,
+				},
+			})
+			c.Logger.WithFields(log.Fields{"startup": true}).Warn(message)
+			continue
+		}
+		checkers = append(checkers, factory(c))
+	}
+	return checkers
+}
+
+// setupCheckers builds the checker list of each checkpath, and of the folders listed in the deprecated pathchecks.
+// Without a checks list, scripts run after the built in stages. Profiles already built from the current config are
+// kept, so config problems are only logged once.
+func (c *Checkrr) setupCheckers() {
+	if c.profilesFrom == c.config {
+		return
+	}
+	c.loadProfiles()
+	c.profilesFrom = c.config
+}
+
+// checkersFor returns the stages for a file, those of the most specific checkpath or pathchecks entry it is in
+func (c *Checkrr) checkersFor(path string) []Checker {
+	return c.profileOf(path).checkers
+}
@@ -0,0 +1,291 @@
+package check
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/vansante/go-ffprobe.v2"
+)
+
+func init() {
+	RegisterChecker("ffprobe", func(c *Checkrr) Checker { return &probeChecker{c: c} })
+	RegisterChecker("requireaudio", func(c *Checkrr) Checker { return &requireAudioChecker{c: c} })
+	RegisterChecker("codecs", func(c *Checkrr) Checker { return &codecChecker{c: c} })
+	RegisterChecker("ffmpeg-quick", func(c *Checkrr) Checker { return &ffmpegChecker{c: c, quick: true} })
+	RegisterChecker("ffmpeg-full", func(c *Checkrr) Checker { return &ffmpegChecker{c: c} })
+}
+
+// probeChecker runs ffprobe against the file and makes the result available to the stages after it
+type probeChecker struct {
+	c *Checkrr
+}
+
+func (p *probeChecker) Name() string {
+	return "ffprobe"
+}
+
+func (p *probeChecker) Check(file *FileContext) Verdict {
+	c := p.c
+
+	c.probeSlots <- struct{}{}
+	probeCtx, probeCancel := context.WithTimeout(file.Ctx, 30*time.Second)
+	data, err := ffprobe.ProbeURL(probeCtx, file.Path)
+	probeCancel()
+	<-c.probeSlots
+	if file.Ctx.Err() != nil {
+		return Verdict{Result: Inconclusive}
+	}
+	if err != nil {
+		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "CheckErrorReading",
+			TemplateData: map[string]interface{}{
+				"Path":  file.Path,
+				"Error": err.Error(),
+			},
+		})
+		c.Logger.WithFields(log.Fields{"FFProbe": "failed", "Type": file.Type}).Warn(message)
+		// a single failed probe can be a flaky mount or a sleeping disk, make sure it happens twice
+		if c.confirmFailures && !file.Verifying && !c.confirmSuspect(file.Path, err.Error()) {
+			return Verdict{Result: Inconclusive}
+		}
+		return Verdict{Result: Fail, Reason: "data problem", Details: map[string]interface{}{"error": err.Error()}}
+	}
+	if c.confirmFailures && !file.Verifying {
+		c.clearSuspect(file.Path)
+	}
+	c.Logger.WithFields(log.Fields{"Format": data.Format.FormatLongName, "Type": file.Type, "FFProbe": true}).Infof(data.Format.Filename)
+	c.Logger.Debug(data.Format.FormatName)
+
+	file.Probe = data
+	return Verdict{Result: Pass}
+}
+
+// requireAudioChecker fails files that have no audio streams at all
+type requireAudioChecker struct {
+	c *Checkrr
+}
+
+func (r *requireAudioChecker) Name() string {
+	return "requireaudio"
+}
+
+func (r *requireAudioChecker) Check(file *FileContext) Verdict {
+	c := r.c
+	data := file.Probe
+	if data == nil {
+		return Verdict{Result: Pass}
+	}
+
+	for _, stream := range data.Streams {
+		if stream.CodecType == "audio" {
+			return Verdict{Result: Pass}
+		}
+	}
+
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckNoAudioStream",
+		TemplateData: map[string]interface{}{
+			"Path": file.Path,
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Format": data.Format.FormatLongName, "Type": file.Type, "FFProbe": true, "NoAudio": true}).Info(message)
+	return Verdict{Result: Fail, Reason: "no audio streams"}
+}
+
+// codecChecker applies the removevideo, removeaudio and removelang lists to the probed streams
+type codecChecker struct {
+	c *Checkrr
+}
+
+func (cc *codecChecker) Name() string {
+	return "codecs"
+}
+
+func (cc *codecChecker) Check(file *FileContext) Verdict {
+	c := cc.c
+	p := file.Profile
+	data := file.Probe
+	if data == nil {
+		return Verdict{Result: Pass}
+	}
+
+	if file.Type == "Video" {
+		// streams that break a strip rule, they are remuxed out after every stream has been looked at
+		var strip []int
+		var stripReason string
+		// subtitle streams in a removed language that a Bazarr can replace, the video itself is fine so they don't
+		// fail it
+		var subtitles []int
+	streams:
+		for _, stream := range data.Streams {
+			c.Logger.Debug(stream.CodecName)
+			for _, codec := range p.removeVideo {
+				if stream.CodecName == codec {
+					message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+						MessageID: "CheckFormatDetected",
+						TemplateData: map[string]interface{}{
+							"Codec": data.FirstVideoStream().CodecName,
+						},
+					})
+					c.Logger.WithFields(log.Fields{"Format": data.Format.FormatLongName, "Type": file.Type, "FFProbe": true, "Codec": stream.CodecName}).Info(message)
+					return Verdict{Result: Fail, Reason: "video codec", Details: map[string]interface{}{"codec": stream.CodecName, "stream": stream.Index}}
+				}
+			}
+			for _, codec := range p.removeAudio {
+				if stream.CodecName == codec {
+					message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+						MessageID: "CheckFormatDetected",
+						TemplateData: map[string]interface{}{
+							"Codec": data.FirstAudioStream().CodecName,
+						},
+					})
+					c.Logger.WithFields(log.Fields{"Format": data.Format.FormatLongName, "Type": file.Type, "FFProbe": true, "Codec": stream.CodecName}).Info(message)
+					if p.stripAudio && stream.CodecType == "audio" {
+						strip = append(strip, stream.Index)
+						stripReason = "audio codec"
+						continue streams
+					}
+					return Verdict{Result: Fail, Reason: "audio codec", Details: map[string]interface{}{"codec": stream.CodecName, "stream": stream.Index}}
+				}
+			}
+			for _, language := range p.removeLang {
+				streamlang, err := stream.TagList.GetString("Language")
+				if err == nil {
+					if streamlang == language {
+						message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+							MessageID: "CheckFormatDetected",
+							TemplateData: map[string]interface{}{
+								"Codec": streamlang,
+							},
+						})
+						c.Logger.WithFields(log.Fields{"Format": data.Format.FormatLongName, "Type": file.Type, "FFProbe": true, "Codec": stream.CodecName, "Language": streamlang}).Info(message)
+						if p.stripLang && (stream.CodecType == "audio" || stream.CodecType == "subtitle") {
+							strip = append(strip, stream.Index)
+							stripReason = "audio lang"
+							if stream.CodecType == "subtitle" {
+								stripReason = "subtitle lang"
+							}
+							continue streams
+						}
+						if stream.CodecType == "subtitle" && c.bazarrManages(file) {
+							subtitles = append(subtitles, stream.Index)
+							continue streams
+						}
+						return Verdict{Result: Fail, Reason: "audio lang", Details: map[string]interface{}{"language": streamlang, "stream": stream.Index}}
+					}
+				} else {
+					message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+						MessageID: "CheckAudioStreamError",
+					})
+					c.Logger.WithFields(log.Fields{"Format": data.Format.FormatLongName, "Type": file.Type, "FFProbe": true, "Codec": stream.CodecName, "Language": "unknown"}).Warn(message)
+				}
+			}
+		}
+		if len(subtitles) > 0 {
+			c.subtitleLanguage(file, subtitles)
+		}
+		if len(strip) > 0 {
+			return c.stripStreams(file, strip, stripReason)
+		}
+		return Verdict{Result: Pass}
+	}
+
+	if data.FirstAudioStream() == nil {
+		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "CheckAudioStreamMissing",
+			TemplateData: map[string]interface{}{
+				"Path": file.Path,
+			},
+		})
+		c.Logger.WithFields(log.Fields{"Format": data.Format.FormatLongName, "Type": file.Type, "FFProbe": true, "Codec": "unknown"}).Info(message)
+		return Verdict{Result: Fail, Reason: "no audio in video"}
+	}
+
+	c.Logger.Debug(data.FirstAudioStream().CodecName)
+	for _, stream := range data.Streams {
+		c.Logger.Debug(stream.CodecName)
+		for _, codec := range p.removeAudio {
+			if stream.CodecName == codec {
+				message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+					MessageID: "CheckFormatDetected",
+					TemplateData: map[string]interface{}{
+						"Codec": data.FirstAudioStream().CodecName,
+					},
+				})
+				c.Logger.WithFields(log.Fields{"Format": data.Format.FormatLongName, "Type": file.Type, "FFProbe": true, "Codec": stream.CodecName}).Info(message)
+				return Verdict{Result: Fail, Reason: "audio codec", Details: map[string]interface{}{"codec": stream.CodecName, "stream": stream.Index}}
+			}
+		}
+	}
+	return Verdict{Result: Pass}
+}
+
+// ffmpegChecker decodes the file with ffmpeg, either the first ffmpeg-quick-seconds or the whole thing
+type ffmpegChecker struct {
+	c     *Checkrr
+	quick bool
+}
+
+func (f *ffmpegChecker) Name() string {
+	if f.quick {
+		return "ffmpeg-quick"
+	}
+	return "ffmpeg-full"
+}
+
+func (f *ffmpegChecker) Check(file *FileContext) Verdict {
+	c := f.c
+	field := "FFMPEG-Full"
+
+	// use the run context with no timeout because we want to check the whole file, it is only cancelled when the
+	// run is stopped
+	ctx := file.Ctx
+	args := []string{
+		"-v", "error",
+		"-i", file.Path,
+		"-hwaccel", "auto",
+	}
+
+	if f.quick {
+		field = "FFMPEG-quick"
+		seconds := c.ffMpegQuickSeconds
+		if seconds <= 0 {
+			seconds = 10
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(seconds+10)*time.Second)
+		defer cancel()
+		args = append(args, "-t", fmt.Sprintf("%d", seconds))
+		c.Logger.WithFields(log.Fields{field: true}).Debugf("Running FFmpeg, Quick %d Seconds", seconds)
+	} else {
+		c.Logger.WithFields(log.Fields{field: true}).Debug("Running FFmpeg, Full")
+	}
+	args = append(args, "-f", "null", "-")
+
+	c.ffmpegSlots <- struct{}{}
+	out, err := runFFmpeg(ctx, args)
+	<-c.ffmpegSlots
+	if file.Ctx.Err() != nil {
+		// the run was stopped, ffmpeg was killed part way through
+		return Verdict{Result: Inconclusive}
+	}
+	if err != nil {
+		if !errors.Is(err, context.DeadlineExceeded) {
+			// exec failure (ffmpeg missing, killed, etc)
+			c.Logger.WithFields(log.Fields{field: true}).Error(err)
+			// if ffmpeg errored, we should not trust the output
+			return Verdict{Result: Inconclusive}
+		}
+	}
+
+	// ffmpeg returns stderr lines when corrupt (because -v error)
+	if strings.TrimSpace(out) != "" {
+		return Verdict{Result: Fail, Reason: out}
+	}
+	return Verdict{Result: Pass}
+}
@@ -0,0 +1,266 @@
+package check
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// checkpoint is how far a run got. Everything up to and including LastPath under Checkpath has been checked. Roots
+// are the checkpaths the run covered, a scheduled run only covers the ones on its cron.
+type checkpoint struct {
+	Roots     []string        `json:"roots,omitempty"`
+	Checkpath string          `json:"checkpath"`
+	LastPath  string          `json:"lastPath"`
+	Stats     json.RawMessage `json:"stats"`
+}
+
+const (
+	// checkpointEvery and checkpointInterval limit how often the checkpoint is written, whichever comes first
+	checkpointEvery    = 100
+	checkpointInterval = 30 * time.Second
+)
+
+// progress tracks which walked files have been checked. Workers finish out of order, so the checkpoint only moves
+// past a file once everything walked before it is done as well. The stats counters move with it, so a checkpoint
+// never counts a file that the resumed run will check again.
+type progress struct {
+	mu      sync.Mutex
+	pending []progressEntry
+	done    map[string]tally
+	// counts are the stats counters as of last
+	counts map[string]uint64
+	last   progressEntry
+	// unsaved is how many files the checkpoint moved past since it was last written
+	unsaved int
+	saved   time.Time
+}
+
+type progressEntry struct {
+	root string
+	path string
+}
+
+// tally is what one file added to the stats counters
+type tally map[string]uint64
+
+type tallyKey struct{}
+
+// newProgress starts tracking a run whose stats counters are at counts
+func newProgress(counts map[string]uint64) *progress {
+	return &progress{done: map[string]tally{}, counts: counts, saved: time.Now()}
+}
+
+// walked records a file in the order the walker handed it out
+func (p *progress) walked(root string, path string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = append(p.pending, progressEntry{root: root, path: path})
+}
+
+// checked marks a file as done along with what it added to the stats. When the checkpoint has moved far enough, or
+// long enough ago, to be written again it returns the newest entry that is safe to checkpoint and the counters as of
+// that entry.
+func (p *progress) checked(path string, counted tally) (progressEntry, map[string]uint64, bool) {
+	if p == nil {
+		return progressEntry{}, nil, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done[path] = counted
+
+	for len(p.pending) > 0 {
+		counted, ok := p.done[p.pending[0].path]
+		if !ok {
+			break
+		}
+		for field, n := range counted {
+			p.counts[field] += n
+		}
+		p.last = p.pending[0]
+		delete(p.done, p.last.path)
+		p.pending = p.pending[1:]
+		p.unsaved++
+	}
+	if p.unsaved == 0 || (p.unsaved < checkpointEvery && time.Since(p.saved) < checkpointInterval) {
+		return progressEntry{}, nil, false
+	}
+	return p.take()
+}
+
+// flush returns the newest entry that is safe to checkpoint if it hasn't been written yet, for when a run stops
+func (p *progress) flush() (progressEntry, map[string]uint64, bool) {
+	if p == nil {
+		return progressEntry{}, nil, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.unsaved == 0 {
+		return progressEntry{}, nil, false
+	}
+	return p.take()
+}
+
+// take hands out the entry and a copy of the counters to write. p.mu has to be held.
+func (p *progress) take() (progressEntry, map[string]uint64, bool) {
+	p.unsaved = 0
+	p.saved = time.Now()
+	return p.last, maps.Clone(p.counts), true
+}
+
+// count bumps a stats counter for the file checked with ctx. The run workers tally what each file counts, so the
+// counters can move with the checkpoint.
+func (c *Checkrr) count(ctx context.Context, field string) {
+	c.Stats.Increment(field)
+	if ctx == nil {
+		return
+	}
+	if counted, ok := ctx.Value(tallyKey{}).(tally); ok {
+		counted[field]++
+	}
+}
+
+// HasCheckpoint reports whether an interrupted run left a checkpoint behind
+func (c *Checkrr) HasCheckpoint() bool {
+	_, ok := c.loadCheckpoint()
+	return ok
+}
+
+func (c *Checkrr) loadCheckpoint() (checkpoint, bool) {
+	cp := checkpoint{}
+	found := false
+	err := c.DB.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte("Checkrr-checkpoint")).Get([]byte("checkpoint"))
+		if v == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(v, &cp)
+	})
+	if err != nil {
+		c.logCheckpointError(err)
+		return cp, false
+	}
+	return cp, found
+}
+
+// saveCheckpoint writes the position and the stats counters as of that position in one go
+func (c *Checkrr) saveCheckpoint(entry progressEntry, counts map[string]uint64) {
+	stats, err := c.Stats.Checkpoint(counts)
+	if err != nil {
+		c.logCheckpointError(err)
+		return
+	}
+	data, err := json.Marshal(checkpoint{Roots: c.roots, Checkpath: entry.root, LastPath: entry.path, Stats: stats})
+	if err != nil {
+		c.logCheckpointError(err)
+		return
+	}
+	err = c.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("Checkrr-checkpoint")).Put([]byte("checkpoint"), data)
+	})
+	if err != nil {
+		c.logCheckpointError(err)
+	}
+}
+
+func (c *Checkrr) clearCheckpoint() {
+	err := c.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("Checkrr-checkpoint")).Delete([]byte("checkpoint"))
+	})
+	if err != nil {
+		c.logCheckpointError(err)
+	}
+}
+
+// resumeCheckpoint loads the checkpoint for a resumed run and restores its stats. It returns the checkpaths the
+// interrupted run covered and the index of the one to start from, or false if the run should start from scratch
+// on checkpaths.
+func (c *Checkrr) resumeCheckpoint(checkpaths []string) (checkpoint, []string, int, bool) {
+	cp, ok := c.loadCheckpoint()
+	if !ok {
+		return cp, checkpaths, 0, false
+	}
+	roots := checkpaths
+	if len(cp.Roots) > 0 {
+		roots = nil
+		configured := c.checkpaths()
+		for _, root := range cp.Roots {
+			if slices.Contains(configured, root) {
+				roots = append(roots, root)
+			}
+		}
+	}
+	for i, root := range roots {
+		if root != cp.Checkpath {
+			continue
+		}
+		err := c.Stats.Resume(cp.Stats)
+		if err != nil {
+			c.logCheckpointError(err)
+			return cp, checkpaths, 0, false
+		}
+		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "CheckResuming",
+			TemplateData: map[string]interface{}{
+				"Path": cp.LastPath,
+			},
+		})
+		c.Logger.WithFields(log.Fields{"Resume": true}).Info(message)
+		return cp, roots, i, true
+	}
+	// the checkpaths changed since the checkpoint was taken
+	return cp, checkpaths, 0, false
+}
+
+// skipWalked tells the walker whether a path was already covered by the checkpoint. Directories that were finished
+// before the checkpoint are skipped entirely.
+func skipWalked(path string, d fs.DirEntry, last string) (bool, error) {
+	if !walkedBefore(path, last) && path != last {
+		return false, nil
+	}
+	if d.IsDir() {
+		if path == last || strings.HasPrefix(last, path+string(filepath.Separator)) {
+			// the checkpoint is somewhere inside this directory
+			return false, nil
+		}
+		return true, filepath.SkipDir
+	}
+	return true, nil
+}
+
+// walkedBefore reports whether filepath.WalkDir visits a before b. WalkDir goes through each directory in lexical
+// order, which isn't the same as comparing the full paths as strings.
+func walkedBefore(a string, b string) bool {
+	as := strings.Split(a, string(filepath.Separator))
+	bs := strings.Split(b, string(filepath.Separator))
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
+		}
+	}
+	return len(as) < len(bs)
+}
+
+func (c *Checkrr) logCheckpointError(err error) {
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckCheckpointError",
+		TemplateData: map[string]interface{}{
+			"Error": err.Error(),
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Resume": true}).Warn(message)
+}
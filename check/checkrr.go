@@ -5,14 +5,15 @@ import (
 	"context"
 	"encoding/hex"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aetaric/checkrr/logging"
@@ -28,45 +29,73 @@ import (
 	"github.com/kalafut/imohash"
 	log "github.com/sirupsen/logrus"
 	bolt "go.etcd.io/bbolt"
-	"gopkg.in/vansante/go-ffprobe.v2"
 )
 
 type Checkrr struct {
 	Stats              features.Stats
 	DB                 *bolt.DB
 	Running            bool
+	runLock            sync.Mutex
 	csv                features.CSV
 	notifications      notifications.Notifications
 	sonarr             []connections.Sonarr
 	radarr             []connections.Radarr
 	lidarr             []connections.Lidarr
-	ignoreExts         []string
-	ignorePaths        []string
-	removeVideo        []string
-	removeAudio        []string
-	removeLang         []string
-	ignoreHidden       bool
-	requireAudio       bool
-	ffProbe            bool
-	ffMpegFull         bool
-	ffMpegQuick        bool
+	readarr            []connections.Readarr
+	bazarr             []connections.Bazarr
 	ffMpegQuickSeconds int64
+	action             string
+	dryRun             bool
+	confirmFailures    bool
+	suspectDelay       time.Duration
+	suspects           []string
+	suspectTimers      map[string]*time.Timer
+	suspectLock        sync.Mutex
+	jobs               []*job
+	queueLock          sync.Mutex
+	draining           bool
+	closed             bool
+	quarantinePath     string
+	profiles           []*PathProfile
+	defaults           *PathProfile
+	profilesFrom       *koanf.Koanf
+	roots              []string
+	queuedPaths        []string
+	queuedAt           time.Time
+	scripts            map[string]CheckerFactory
+	probeSlots         chan struct{}
+	ffmpegSlots        chan struct{}
+	progress           *progress
+	Resume             bool
+	ctx                context.Context
+	cancel             context.CancelFunc
+	shutdown           bool
+	done               chan struct{}
+	hashAlgo           string
+	verifyEvery        int
+	verifyRun          int64
 	FullConfig         *koanf.Koanf
+	reloaded           *koanf.Koanf
 	config             *koanf.Koanf
 	Chan               *chan []string
 	Logger             *logging.Log
 	Localizer          *i18n.Localizer
 }
 
+// Run checks every checkpath, ignoring their schedules. Cron runs go through ScheduledRun instead. It waits its turn
+// behind anything already queued and returns once the run is over.
 func (c *Checkrr) Run() {
+	<-c.queueWalk(c.checkpaths())
+}
+
+func (c *Checkrr) run(checkpaths []string) {
 
 	// Prevent multiple checkrr goroutines from running
-	if !c.Running {
+	if c.tryLock() {
 		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
 			MessageID: "CheckDebugMultiRun",
 		})
 		c.Logger.Debug(message)
-		c.Running = true
 	} else {
 		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
 			MessageID: "CheckMultiRunError",
@@ -75,64 +104,55 @@ func (c *Checkrr) Run() {
 		return
 	}
 
-	c.Stats = features.Stats{Log: *c.Logger, DB: c.DB, Localizer: c.Localizer}
-	c.Stats.FromConfig(*c.FullConfig.Cut("stats"))
+	c.prepare()
 
-	// Connect to Sonarr, Radarr, and Lidarr
-	c.connectServices()
-
-	// Connect to notifications
-	c.connectNotifications()
+	title := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "NotificationsRunStartedTitle",
+	})
+	desc := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "NotificationsRunStartedDesc",
+	})
+	c.notifications.Notify(title, desc, "startrun", "")
 
-	// Setup CSV writer
-	if c.config.String("csvfile") != "" {
-		c.csv = features.CSV{FilePath: c.config.String("csvfile"), Log: c.Logger, Localizer: c.Localizer}
-		c.csv.Open()
+	// pick up where an interrupted run left off, if we were asked to
+	var cp checkpoint
+	start := 0
+	resuming := false
+	if c.Resume {
+		c.Resume = false
+		cp, checkpaths, start, resuming = c.resumeCheckpoint(checkpaths)
 	}
-
-	c.ignoreExts = c.config.Strings("ignoreexts")
-	c.ignorePaths = c.config.Strings("ignorepaths")
-	c.removeVideo = c.config.Strings("removevideo")
-	c.removeAudio = c.config.Strings("removeaudio")
-	c.removeLang = c.config.Strings("removelang")
-	c.ignoreHidden = c.config.Bool("ignorehidden")
-	c.requireAudio = c.config.Bool("requireaudio")
-	c.ffMpegFull = c.config.Bool("ffmpeg-full")
-	c.ffMpegQuick = c.config.Bool("ffmpeg-quick")
-	c.ffMpegQuickSeconds = c.config.Int64("ffmpeg-quick-seconds")
-	c.ffProbe = c.config.Bool("ffprobe")
-
-	// warn if ffprobe is disabled and defined flags need it
-	if !c.ffProbe {
-		if len(c.removeVideo) > 0 {
-			c.Logger.Warn("remove video flag is set, but ffprobe is disabled. codec based removal will not run")
-		}
-		if len(c.removeAudio) > 0 {
-			c.Logger.Warn("remove audio flag is set, but ffprobe is disabled. codec based removal will not run")
-		}
-		if len(c.removeLang) > 0 {
-			c.Logger.Warn("remove language flag is set, but ffprobe is disabled. codec based removal will not run")
-		}
-		if c.requireAudio {
-			c.Logger.Warn("require audio flag is set, but ffprobe is disabled. codec based removal will not run")
-		}
+	c.roots = checkpaths
+	c.Logger.Debug(checkpaths)
+	if !resuming {
+		c.Stats.Start()
 	}
+	c.countRun(resuming)
 
-	// I'm tired of waiting for filetype to support this. We'll force it by adding to the matchers on the fly.
-	// TODO: if h2non/filetype#120 ever gets completed, remove this logic
-	ts := filetype.AddType("ts", "MPEG-TS")
-	m2ts := filetype.AddType("m2ts", "MPEG-TS")
-	matchers.Video[ts] = mpegtsMatcher
-	matchers.Video[m2ts] = mpegtsMatcher
+	c.progress = newProgress(c.Stats.Counters())
+	paths, wg := c.startWorkers()
 
-	c.Stats.Start()
-
-	c.Logger.Debug(c.config.Strings("checkpath"))
+	// a checkpath inside another one is walked on its own, with its own settings and schedule
+	own := map[string]bool{}
+	for _, path := range c.checkpaths() {
+		own[filepath.Clean(path)] = true
+	}
 
-	for _, path := range c.config.Strings("checkpath") {
-		c.Logger.WithFields(log.Fields{"startup": true}).Debugf("Path: %v", path)
+	for i, root := range checkpaths[start:] {
+		c.Logger.WithFields(log.Fields{"startup": true}).Debugf("Path: %v", root)
 
-		err := filepath.WalkDir(path, func(path string, d os.DirEntry, err error) error {
+		if c.ctx.Err() != nil {
+			break
+		}
+		err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if c.ctx.Err() != nil {
+				return filepath.SkipAll
+			}
+			if resuming && i == 0 && err == nil {
+				if skip, skipErr := skipWalked(path, d, cp.LastPath); skip {
+					return skipErr
+				}
+			}
 			if err != nil {
 				message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
 					MessageID: "CheckWalkDirError",
@@ -143,94 +163,26 @@ func (c *Checkrr) Run() {
 				c.Logger.Warnf(message)
 				return err // we need to return here. we will fail all checks otherwise.
 			}
-			if !d.IsDir() {
-				var ignore = false
-
-				ext := filepath.Ext(path)
-				for _, v := range c.ignoreExts {
-					if strings.EqualFold(v, ext) {
-						ignore = true
-					}
+			if d.IsDir() {
+				if path != root && own[filepath.Clean(path)] {
+					return filepath.SkipDir
 				}
-
-				if c.ignoreHidden {
-					i, _ := hidden.IsHidden(path)
-					if !ignore {
-						ignore = i
-					}
+				if path != root && c.ignoredDir(path) {
+					c.Logger.WithFields(log.Fields{"Ignored": true}).Debugf("\"%s\"", path)
+					return filepath.SkipDir
 				}
-
-				for _, v := range c.ignorePaths {
-					if strings.Contains(path, v) {
-						if !ignore {
-							ignore = true
-						}
-					}
+				if c.queued(path) {
+					return filepath.SkipDir
 				}
-
-				if !ignore {
-					c.Stats.FilesChecked++
-					c.Stats.Write("FilesChecked", c.Stats.FilesChecked)
-					var hash = []byte(nil)
-
-					err := c.DB.View(func(tx *bolt.Tx) error {
-						b := tx.Bucket([]byte("Checkrr"))
-						v := b.Get([]byte(path))
-						if v != nil {
-							hash = v
-						}
-						return nil
-					})
-					if err != nil {
-						message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
-							MessageID: "DBAccessFail",
-							TemplateData: map[string]interface{}{
-								"Path": err.Error(),
-							},
-						})
-						c.Logger.Fatal(message)
-					}
-
-					if hash == nil {
-						message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
-							MessageID: "CheckDebugHashNotFound",
-							TemplateData: map[string]interface{}{
-								"Path": path,
-							},
-						})
-						c.Logger.WithFields(log.Fields{"DB Hash": "Not Found"}).Debug(message)
-						c.checkFile(path)
-					} else {
-						message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
-							MessageID: "CheckDebugDBHash",
-							TemplateData: map[string]interface{}{
-								"Hash": hash,
-							},
-						})
-						c.Logger.WithFields(log.Fields{"DB Hash": "Found"}).Debug(message)
-
-						filehash := imohash.New()
-						sum, _ := filehash.SumFile(path)
-
-						message = c.Localizer.MustLocalize(&i18n.LocalizeConfig{
-							MessageID: "CheckDebugFileHash",
-							TemplateData: map[string]interface{}{
-								"Hash": hex.EncodeToString(sum[:]),
-							},
-						})
-						c.Logger.WithFields(log.Fields{"DB Hash": "Found", "File Hash": "Computed"}).Debug(message)
-
-						if hex.EncodeToString(sum[:]) != hex.EncodeToString(hash[:]) {
-							c.Logger.WithFields(log.Fields{"Hash Match": false}).Infof("\"%v\"", path)
-							c.Stats.HashMismatches++
-							c.Stats.Write("HashMismatches", c.Stats.HashMismatches)
-							c.checkFile(path)
-						} else {
-							c.Logger.WithFields(log.Fields{"Hash Match": true}).Infof("\"%v\"", path)
-							c.Stats.HashMatches++
-							c.Stats.Write("HashMatches", c.Stats.HashMatches)
-						}
-					}
+			} else {
+				if c.queued(path) || c.tooNew(path, d) {
+					// still being written, the next run gets it
+					return nil
+				}
+				if !c.ignored(path) {
+					c.Stats.Increment("FilesChecked")
+					c.progress.walked(root, path)
+					paths <- path
 				} else {
 					c.Logger.WithFields(log.Fields{"Ignored": true}).Debugf("\"%s\"", path)
 				}
@@ -244,32 +196,405 @@ func (c *Checkrr) Run() {
 					"Error": err.Error(),
 				},
 			})
-			c.Logger.WithFields(log.Fields{"path": path}).Error(message)
+			c.Logger.WithFields(log.Fields{"path": root}).Error(message)
 		}
 	}
+	close(paths)
+	wg.Wait()
+	// a run stopped by shutdown picks back up on the next start, anything else is over
+	if !c.shutdown {
+		c.clearCheckpoint()
+	} else if entry, counts, due := c.progress.flush(); due {
+		c.saveCheckpoint(entry, counts)
+	}
+	c.progress = nil
 
-	title := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
-		MessageID: "NotificationsRunFinishTitle",
-	})
-	desc := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
-		MessageID: "NotificationsRunFinishDesc",
+	if c.confirmFailures {
+		c.recheckSuspects()
+	}
+	c.deepScan(c.ctx)
+
+	if c.ctx.Err() == nil {
+		title = c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "NotificationsRunFinishTitle",
+		})
+		desc = c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "NotificationsRunFinishDesc",
+		})
+		c.notifications.Notify(title, desc, "endrun", "")
+	}
+	c.finish(false)
+	ch := *c.Chan
+	ch <- []string{"time"}
+}
+
+// runFiles checks a specific set of files outside the schedule, for watch mode, arr imports and suspect rechecks.
+// It is run from the queue, so it never overlaps a walk.
+func (c *Checkrr) runFiles(targets []string) {
+	if !c.tryLock() {
+		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "CheckMultiRunError",
+		})
+		c.Logger.Error(message)
+		return
+	}
+
+	c.prepare()
+	c.Stats.Start()
+
+	paths, wg := c.startWorkers()
+	for _, path := range targets {
+		if c.ignored(path) {
+			c.Logger.WithFields(log.Fields{"Ignored": true}).Debugf("\"%s\"", path)
+			continue
+		}
+		if c.queued(path) {
+			continue
+		}
+		c.Stats.Increment("FilesChecked")
+		paths <- path
+	}
+	close(paths)
+	wg.Wait()
+
+	if c.confirmFailures {
+		c.recheckSuspects()
+	}
+	c.finish(true)
+}
+
+// tryLock marks checkrr as running, reporting false if a run was already in progress
+func (c *Checkrr) tryLock() bool {
+	c.runLock.Lock()
+	defer c.runLock.Unlock()
+	if c.Running {
+		return false
+	}
+	c.Running = true
+	if c.reloaded != nil {
+		c.config, c.reloaded = c.reloaded, nil
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.shutdown = false
+	c.done = make(chan struct{})
+	return true
+}
+
+// Stop cancels the current run. Running ffprobe and ffmpeg processes are killed and the run is recorded as
+// cancelled. Pending suspect rechecks are left for the next run. It returns false if nothing was running.
+func (c *Checkrr) Stop() bool {
+	c.stopSuspectTimers()
+	c.runLock.Lock()
+	defer c.runLock.Unlock()
+	if !c.Running {
+		return false
+	}
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckRunStopping",
 	})
-	c.notifications.Notify(title, desc, "endrun", "")
-	c.Stats.Stop()
+	c.Logger.Warn(message)
+	c.cancel()
+	return true
+}
+
+// Shutdown stops the current run like Stop, but keeps its checkpoint so it is resumed on the next start. It waits
+// for the run to wrap up.
+func (c *Checkrr) Shutdown() {
+	c.closeQueue()
+	c.stopSuspectTimers()
+	c.runLock.Lock()
+	if !c.Running {
+		c.runLock.Unlock()
+		return
+	}
+	c.shutdown = true
+	done := c.done
+	c.runLock.Unlock()
+
+	c.Stop()
+	<-done
+}
+
+// prepare loads the config and connects everything a run needs
+func (c *Checkrr) prepare() {
+	c.Stats = features.Stats{Log: *c.Logger, DB: c.DB, Localizer: c.Localizer}
+	c.Stats.FromConfig(*c.FullConfig.Cut("stats"))
+
+	// Connect to Sonarr, Radarr, Lidarr, Readarr and Bazarr
+	c.connectServices()
+
+	// Connect to notifications
+	c.connectNotifications()
+
+	// Setup CSV writer
+	if c.config.String("csvfile") != "" {
+		c.csv = features.CSV{FilePath: c.config.String("csvfile"), Log: c.Logger, Localizer: c.Localizer}
+		c.csv.Open()
+	}
+
+	c.ffMpegQuickSeconds = c.config.Int64("ffmpeg-quick-seconds")
+	c.queuedAt = time.Time{}
+	c.action = c.config.String("action")
+	c.dryRun = c.config.Bool("dryrun")
+	c.confirmFailures = c.config.Bool("confirmfailures")
+	c.suspectDelay = c.config.Duration("suspectdelay")
+	c.quarantinePath = c.config.String("quarantinepath")
+
+	if c.action == "quarantine" && c.quarantinePath == "" {
+		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "QuarantineMissingPath",
+		})
+		c.Logger.Warn(message)
+		c.action = "reacquire"
+	}
+
+	c.setupCheckers()
+	c.setupFullHash()
+
+	// I'm tired of waiting for filetype to support this. We'll force it by adding to the matchers on the fly.
+	// TODO: if h2non/filetype#120 ever gets completed, remove this logic
+	ts := filetype.AddType("ts", "MPEG-TS")
+	m2ts := filetype.AddType("m2ts", "MPEG-TS")
+	matchers.Video[ts] = mpegtsMatcher
+	matchers.Video[m2ts] = mpegtsMatcher
+
+	if c.dryRun {
+		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "CheckDryRunEnabled",
+		})
+		c.Logger.WithFields(log.Fields{"startup": true}).Warn(message)
+	}
+}
+
+// finish records the stats for a run and releases the run lock. A batch of files checked outside a run isn't kept in
+// the run history.
+func (c *Checkrr) finish(batch bool) {
+	if c.ctx.Err() != nil {
+		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "CheckRunCancelled",
+		})
+		c.Logger.Warn(message)
+		c.Stats.Cancelled = true
+	}
+	if batch {
+		c.Stats.StopBatch()
+	} else {
+		c.Stats.Stop()
+	}
 	c.Stats.Render()
 	if c.config.String("csvfile") != "" {
 		c.csv.Close()
 	}
+	c.runLock.Lock()
 	c.Running = false
-	ch := *c.Chan
-	ch <- []string{"time"}
+	c.cancel()
+	close(c.done)
+	c.runLock.Unlock()
+}
+
+// startWorkers starts the check workers. Files sent on the returned channel are checked until it is closed.
+func (c *Checkrr) startWorkers() (chan string, *sync.WaitGroup) {
+	// Files are handed to a pool of workers so a single slow ffmpeg pass doesn't hold up the rest of the library.
+	// ffprobe and ffmpeg get their own slot pools so full decodes can't starve the cheap probes.
+	workers := c.config.Int("workers")
+	if workers <= 0 {
+		workers = 1
+	}
+	c.probeSlots = newSlots(c.config.Int("ffprobe-workers"), workers)
+	c.ffmpegSlots = newSlots(c.config.Int("ffmpeg-workers"), workers)
+
+	paths := make(chan string, workers)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				if c.ctx.Err() != nil {
+					// cancelled, drain what the walker already sent
+					continue
+				}
+				// the walker counted the file as checked when it handed it out
+				counted := tally{"FilesChecked": 1}
+				c.checkPath(context.WithValue(c.ctx, tallyKey{}, counted), path)
+				if c.ctx.Err() != nil {
+					// the check was cut short, leave it for the resumed run
+					continue
+				}
+				if entry, counts, due := c.progress.checked(path, counted); due {
+					c.saveCheckpoint(entry, counts)
+				}
+			}
+		}()
+	}
+	return paths, wg
+}
+
+// ignored reports whether a file is excluded by the ignoreexts, ignorehidden, ignorepaths or includepaths of its
+// checkpath
+func (c *Checkrr) ignored(path string) bool {
+	var ignore = false
+	p := c.profileOf(path)
+
+	ext := filepath.Ext(path)
+	for _, v := range p.ignoreExts {
+		if strings.EqualFold(v, ext) {
+			ignore = true
+		}
+	}
+
+	if p.ignoreHidden {
+		i, _ := hidden.IsHidden(path)
+		if !ignore {
+			ignore = i
+		}
+	}
+
+	root := c.patternRoot(p, path)
+	if !ignore && matchPatterns(p.ignorePaths, root, path) {
+		ignore = true
+	}
+	if !ignore && len(p.includePaths) > 0 && !matchPatterns(p.includePaths, root, path) {
+		ignore = true
+	}
+	return ignore
+}
+
+// ignoredDir reports whether ignorepaths covers a whole directory, so the walker can skip it without looking inside
+func (c *Checkrr) ignoredDir(path string) bool {
+	p := c.profileOf(path)
+	return matchPatterns(p.ignorePaths, c.patternRoot(p, path), path)
 }
 
 func (c *Checkrr) FromConfig(conf *koanf.Koanf) {
 	c.config = conf
+	// quarantine restores can come in over the api before the first run, and need the profiles to store a record
+	c.setupCheckers()
+}
+
+// Reload swaps in the checkrr config after it has been reloaded. A run in progress keeps the config it started with
+// and the next run picks up the new one.
+func (c *Checkrr) Reload(conf *koanf.Koanf) {
+	// rechecks scheduled under the old config are left for the next run
+	c.stopSuspectTimers()
+	c.runLock.Lock()
+	defer c.runLock.Unlock()
+	if c.Running {
+		c.reloaded = conf
+		return
+	}
+	c.config = conf
+	c.setupCheckers()
+}
+
+// latestConfig is the config the next run will use
+func (c *Checkrr) latestConfig() *koanf.Koanf {
+	c.runLock.Lock()
+	defer c.runLock.Unlock()
+	if c.reloaded != nil {
+		return c.reloaded
+	}
+	return c.config
+}
+
+// checkPath compares a file against its stored record and runs the full checks when the file is new or has changed.
+// Files whose size, mtime and inode still match the record aren't read at all.
+func (c *Checkrr) checkPath(ctx context.Context, path string) {
+	record, err := c.loadRecord(path)
+	if err != nil {
+		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "DBAccessFail",
+			TemplateData: map[string]interface{}{
+				"Path": err.Error(),
+			},
+		})
+		c.Logger.Fatal(message)
+	}
+
+	if record == nil {
+		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "CheckDebugHashNotFound",
+			TemplateData: map[string]interface{}{
+				"Path": path,
+			},
+		})
+		c.Logger.WithFields(log.Fields{"DB Hash": "Not Found"}).Debug(message)
+		c.checkFile(ctx, path)
+		return
+	}
+
+	if !record.legacy && c.missedStages(path, record) {
+		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "CheckProfileChanged",
+			TemplateData: map[string]interface{}{
+				"Path": path,
+			},
+		})
+		c.Logger.WithFields(log.Fields{"Profile": record.Profile}).Info(message)
+		c.checkFile(ctx, path)
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err == nil && record.unchanged(info) {
+		if c.verifyDue(path) {
+			c.verifyFullHash(ctx, path, record)
+			return
+		}
+		c.Logger.WithFields(log.Fields{"Hash Match": true, "Unchanged": true}).Infof("\"%v\"", path)
+		c.count(ctx, "HashMatches")
+		return
+	}
+
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckDebugDBHash",
+		TemplateData: map[string]interface{}{
+			"Hash": record.Hash,
+		},
+	})
+	c.Logger.WithFields(log.Fields{"DB Hash": "Found"}).Debug(message)
+
+	filehash := imohash.New()
+	sum, _ := filehash.SumFile(path)
+
+	message = c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckDebugFileHash",
+		TemplateData: map[string]interface{}{
+			"Hash": hex.EncodeToString(sum[:]),
+		},
+	})
+	c.Logger.WithFields(log.Fields{"DB Hash": "Found", "File Hash": "Computed"}).Debug(message)
+
+	if hex.EncodeToString(sum[:]) != record.Hash {
+		c.Logger.WithFields(log.Fields{"Hash Match": false}).Infof("\"%v\"", path)
+		c.count(ctx, "HashMismatches")
+		c.checkFile(ctx, path)
+	} else {
+		c.Logger.WithFields(log.Fields{"Hash Match": true}).Infof("\"%v\"", path)
+		c.count(ctx, "HashMatches")
+		// the contents are the same but the record is stale (touched, moved or an old raw hash), refresh it so the next
+		// run can skip hashing
+		err := c.storeRecord(ctx, path, sum)
+		if err != nil {
+			c.logRecordError(path, err)
+		}
+	}
+}
+
+// rootFor returns the most specific checkpath that contains path, or an empty string if none do
+func (c *Checkrr) rootFor(path string) string {
+	found := ""
+	for _, root := range c.checkpaths() {
+		rel, err := filepath.Rel(root, path)
+		if err == nil && !strings.HasPrefix(rel, "..") && len(root) > len(found) {
+			found = root
+		}
+	}
+	return found
 }
 
 func (c *Checkrr) connectServices() {
+	c.sonarr, c.radarr, c.lidarr, c.readarr, c.bazarr = nil, nil, nil, nil, nil
 	if c.FullConfig.Get("arr") != nil {
 		arrConfig := c.FullConfig.Cut("arr")
 		arrKeys := c.FullConfig.Cut("arr").Keys()
@@ -279,7 +604,7 @@ func (c *Checkrr) connectServices() {
 				config := arrConfig.Cut(k)
 
 				if config.String("service") == "sonarr" {
-					sonarr := connections.Sonarr{Log: c.Logger, Localizer: c.Localizer}
+					sonarr := connections.Sonarr{Name: k, Log: c.Logger, Localizer: c.Localizer}
 					sonarr.FromConfig(config)
 					sonarrConnected, sonarrMessage := sonarr.Connect()
 					message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
@@ -296,7 +621,7 @@ func (c *Checkrr) connectServices() {
 				}
 
 				if config.String("service") == "radarr" {
-					radarr := connections.Radarr{Log: c.Logger, Localizer: c.Localizer}
+					radarr := connections.Radarr{Name: k, Log: c.Logger, Localizer: c.Localizer}
 					radarr.FromConfig(config)
 					radarrConnected, radarrMessage := radarr.Connect()
 					message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
@@ -313,7 +638,7 @@ func (c *Checkrr) connectServices() {
 				}
 
 				if config.String("service") == "lidarr" {
-					lidarr := connections.Lidarr{Log: c.Logger, Localizer: c.Localizer}
+					lidarr := connections.Lidarr{Name: k, Log: c.Logger, Localizer: c.Localizer}
 					lidarr.FromConfig(config)
 					lidarrConnected, lidarrMessage := lidarr.Connect()
 					message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
@@ -328,6 +653,40 @@ func (c *Checkrr) connectServices() {
 						c.lidarr = append(c.lidarr, lidarr)
 					}
 				}
+
+				if config.String("service") == "readarr" {
+					readarr := connections.Readarr{Name: k, Log: c.Logger, Localizer: c.Localizer}
+					readarr.FromConfig(config)
+					readarrConnected, readarrMessage := readarr.Connect()
+					message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+						MessageID: "ArrConnectField",
+						TemplateData: map[string]interface{}{
+							"Arr":     k,
+							"Service": "Readarr",
+						},
+					})
+					c.Logger.WithFields(log.Fields{"Startup": true, message: readarrConnected}).Info(readarrMessage)
+					if readarrConnected {
+						c.readarr = append(c.readarr, readarr)
+					}
+				}
+
+				if config.String("service") == "bazarr" {
+					bazarr := connections.Bazarr{Name: k, Log: c.Logger, Localizer: c.Localizer}
+					bazarr.FromConfig(config)
+					bazarrConnected, bazarrMessage := bazarr.Connect()
+					message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+						MessageID: "ArrConnectField",
+						TemplateData: map[string]interface{}{
+							"Arr":     k,
+							"Service": "Bazarr",
+						},
+					})
+					c.Logger.WithFields(log.Fields{"Startup": true, message: bazarrConnected}).Info(bazarrMessage)
+					if bazarrConnected {
+						c.bazarr = append(c.bazarr, bazarr)
+					}
+				}
 			}
 		}
 	}
@@ -344,17 +703,13 @@ func (c *Checkrr) connectNotifications() {
 		})
 		c.Logger.WithFields(log.Fields{"Startup": true, "Notifications Connected": false}).Warn(message)
 	}
-	title := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
-		MessageID: "NotificationsRunStartedTitle",
-	})
-	desc := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
-		MessageID: "NotificationsRunStartedDesc",
-	})
-	c.notifications.Notify(title, desc, "startrun", "")
 }
 
-func (c *Checkrr) checkFile(path string) {
-	ctx := context.Background()
+func (c *Checkrr) checkFile(ctx context.Context, path string) {
+	if c.isSubtitle(path) {
+		c.checkSubtitle(ctx, path)
+		return
+	}
 
 	// This seems like an insane number, but it's only 33KB and will allow detection of all file types via the filetype library
 	f, err := os.Open(path)
@@ -400,202 +755,46 @@ func (c *Checkrr) checkFile(path string) {
 
 	if filetype.IsVideo(buf) || filetype.IsAudio(buf) {
 		if filetype.IsAudio(buf) {
-			c.Stats.AudioFiles++
-			c.Stats.Write("AudioFiles", c.Stats.AudioFiles)
+			c.count(ctx, "AudioFiles")
 			detectedFileType = "Audio"
 		} else {
-			c.Stats.VideoFiles++
-			c.Stats.Write("VideoFiles", c.Stats.VideoFiles)
+			c.count(ctx, "VideoFiles")
 			detectedFileType = "Video"
 		}
-		// FFProbe checks
-		if c.ffProbe {
-			probeCtx, probeCancel := context.WithTimeout(ctx, 30*time.Second)
-			data, err := ffprobe.ProbeURL(probeCtx, path)
-			probeCancel()
-			if err != nil {
-				message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
-					MessageID: "CheckErrorReading",
-					TemplateData: map[string]interface{}{
-						"Path":  path,
-						"Error": err.Error(),
-					},
-				})
-				c.Logger.WithFields(log.Fields{"FFProbe": "failed", "Type": detectedFileType}).Warn(message)
-				c.deleteFile(path, "data problem")
-				data, buf, err = nil, nil, nil
-				return
-			}
-			c.Logger.WithFields(log.Fields{"Format": data.Format.FormatLongName, "Type": detectedFileType, "FFProbe": true}).Infof(data.Format.Filename)
-
-			c.Logger.Debug(data.Format.FormatName)
-
-			if c.requireAudio {
-				hasAudio := false
-				for _, stream := range data.Streams {
-					if stream.CodecType == "audio" {
-						hasAudio = true
-						break
-					}
-				}
 
-				if !hasAudio {
-					message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
-						MessageID: "CheckNoAudioStream",
-						TemplateData: map[string]interface{}{
-							"Path": path,
-						},
-					})
-					c.Logger.WithFields(log.Fields{"Format": data.Format.FormatLongName, "Type": detectedFileType, "FFProbe": true, "NoAudio": true}).Info(message)
-					c.deleteFile(path, "no audio streams")
-					return
-				}
+		file := &FileContext{Ctx: ctx, Path: path, Root: c.rootFor(path), Type: detectedFileType, Header: buf, Profile: c.profileOf(path)}
+		stages := c.checkersFor(path)
+		repaired := false
+		for _, checker := range stages {
+			if repaired && repairable(checker) {
+				// the repaired copy already passed it
+				continue
 			}
-
-			if detectedFileType == "Video" {
-				for _, stream := range data.Streams {
-					c.Logger.Debug(stream.CodecName)
-					for _, codec := range c.removeVideo {
-						if stream.CodecName == codec {
-							message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
-								MessageID: "CheckFormatDetected",
-								TemplateData: map[string]interface{}{
-									"Codec": data.FirstVideoStream().CodecName,
-								},
-							})
-							c.Logger.WithFields(log.Fields{"Format": data.Format.FormatLongName, "Type": detectedFileType, "FFProbe": true, "Codec": stream.CodecName}).Info(message)
-							c.deleteFile(path, "video codec")
-							return
-						}
-					}
-					for _, codec := range c.removeAudio {
-						if stream.CodecName == codec {
-							message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
-								MessageID: "CheckFormatDetected",
-								TemplateData: map[string]interface{}{
-									"Codec": data.FirstAudioStream().CodecName,
-								},
-							})
-							c.Logger.WithFields(log.Fields{"Format": data.Format.FormatLongName, "Type": detectedFileType, "FFProbe": true, "Codec": stream.CodecName}).Info(message)
-							c.deleteFile(path, "audio codec")
-							return
-						}
-					}
-					for _, language := range c.removeLang {
-						streamlang, err := stream.TagList.GetString("Language")
-						if err == nil {
-							if streamlang == language {
-								message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
-									MessageID: "CheckFormatDetected",
-									TemplateData: map[string]interface{}{
-										"Codec": streamlang,
-									},
-								})
-								c.Logger.WithFields(log.Fields{"Format": data.Format.FormatLongName, "Type": detectedFileType, "FFProbe": true, "Codec": stream.CodecName, "Language": streamlang}).Info(message)
-								c.deleteFile(path, "audio lang")
-								return
-							}
-						} else {
-							message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
-								MessageID: "CheckAudioStreamError",
-							})
-							c.Logger.WithFields(log.Fields{"Format": data.Format.FormatLongName, "Type": detectedFileType, "FFProbe": true, "Codec": stream.CodecName, "Language": "unknown"}).Warn(message)
-							//c.deleteFile(path, audio lang)
-						}
-					}
-				}
-			} else {
-				if data.FirstAudioStream() != nil {
-					c.Logger.Debug(data.FirstAudioStream().CodecName)
-					for _, stream := range data.Streams {
-						c.Logger.Debug(stream.CodecName)
-						for _, codec := range c.removeAudio {
-							if stream.CodecName == codec {
-								message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
-									MessageID: "CheckFormatDetected",
-									TemplateData: map[string]interface{}{
-										"Codec": data.FirstAudioStream().CodecName,
-									},
-								})
-								c.Logger.WithFields(log.Fields{"Format": data.Format.FormatLongName, "Type": detectedFileType, "FFProbe": true, "Codec": stream.CodecName}).Info(message)
-								c.deleteFile(path, "audio codec")
-								return
-							}
-						}
-					}
-				} else {
-					message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
-						MessageID: "CheckAudioStreamMissing",
-						TemplateData: map[string]interface{}{
-							"Path": path,
-						},
-					})
-					c.Logger.WithFields(log.Fields{"Format": data.Format.FormatLongName, "Type": detectedFileType, "FFProbe": true, "Codec": "unknown"}).Info(message)
-					c.deleteFile(path, "no audio in video")
-					return
-				}
-			}
-			formatLong = data.Format.FormatLongName
-			buf, data = nil, nil
-		}
-
-		// FFMPEG quick checks
-		if c.ffMpegQuick {
-			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.ffMpegQuickSeconds+10)*time.Second)
-			defer cancel()
-
-			args := []string{
-				"-v", "error",
-				"-i", path,
-				"-hwaccel", "auto",
-				"-t", fmt.Sprintf("%d", c.ffMpegQuickSeconds),
-				"-f", "null", "-",
+			verdict := checker.Check(file)
+			if ctx.Err() != nil {
+				// the run was stopped under the checker, whatever it found can't be trusted
+				return
 			}
-
-			c.Logger.WithFields(log.Fields{"FFMPEG-quick": true}).Debugf("Running FFmpeg, Quick %d Seconds", c.ffMpegQuickSeconds)
-			out, err := runFFmpeg(ctx, args)
-			if err != nil {
-				if !errors.Is(err, context.DeadlineExceeded) {
-					// exec failure (ffmpeg missing, killed, etc)
-					c.Logger.WithFields(log.Fields{"FFMPEG-quick": true}).Error(err)
-					// if ffmpeg errored, we should not trust the output
-					return
+			switch verdict.Result {
+			case Fail:
+				verdict.Check = checker.Name()
+				// the rest of the stages carry on with the repaired file
+				if !repaired && c.repairFile(file, verdict, stages) {
+					repaired = true
+					continue
 				}
-			}
-
-			// ffmpeg returns stderr lines when corrupt (because -v error)
-			if strings.TrimSpace(out) != "" {
-				c.deleteFile(path, out)
+				c.deleteFile(file, verdict)
+				return
+			case Inconclusive:
+				return
 			}
 		}
-
-		// FFMPEG full checks
-		if c.ffMpegFull {
-			// use background because we want to check the whole file
-			ctx := context.Background()
-
-			args := []string{
-				"-v", "error",
-				"-i", path,
-				"-hwaccel", "auto",
-				"-f", "null", "-",
-			}
-			c.Logger.WithFields(log.Fields{"FFMPEG-Full": true}).Debug("Running FFmpeg, Full")
-			out, err := runFFmpeg(ctx, args)
-			if err != nil {
-				if !errors.Is(err, context.DeadlineExceeded) {
-					// exec failure (ffmpeg missing, killed, etc)
-					c.Logger.WithFields(log.Fields{"FFMPEG-Full": true}).Error(err)
-					// if ffmpeg errored, we should not trust the output
-					return
-				}
-			}
-
-			// ffmpeg returns stderr lines when corrupt (because -v error)
-			if strings.TrimSpace(out) != "" {
-				c.deleteFile(path, out)
-			}
+		if file.Probe != nil {
+			formatLong = file.Probe.Format.FormatLongName
 		}
+		// the container stage can rename the file
+		path = file.Path
+		file, buf = nil, nil
 
 		// File hashing
 		fileHash := imohash.New()
@@ -609,11 +808,7 @@ func (c *Checkrr) checkFile(path string) {
 		})
 		c.Logger.WithFields(log.Fields{"Format": formatLong, "Type": detectedFileType, "File Hashed": true}).Debug(message)
 
-		err := c.DB.Update(func(tx *bolt.Tx) error {
-			b := tx.Bucket([]byte("Checkrr"))
-			err := b.Put([]byte(path), sum[:])
-			return err
-		})
+		err := c.storeRecord(ctx, path, sum)
 		if err != nil {
 			message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
 				MessageID: "DBFailure",
@@ -634,8 +829,7 @@ func (c *Checkrr) checkFile(path string) {
 		})
 		c.Logger.WithFields(log.Fields{"FFProbe": false, "Type": "Other"}).Info(message)
 		buf = nil
-		c.Stats.NonVideo++
-		c.Stats.Write("NonVideo", c.Stats.NonVideo)
+		c.count(ctx, "NonVideo")
 		return
 	}
 
@@ -669,18 +863,35 @@ func (c *Checkrr) checkFile(path string) {
 	})
 	c.notifications.Notify(title, desc, "unknowndetected", path)
 
-	c.Stats.UnknownFileCount++
-	c.Stats.Write("UnknownFiles", c.Stats.UnknownFileCount)
-	c.deleteFile(path, "not recognized")
+	c.count(ctx, "UnknownFiles")
+	c.deleteFile(&FileContext{Ctx: ctx, Path: path, Profile: c.profileOf(path)}, Verdict{Result: Fail, Check: "filetype", Reason: "not recognized"})
 	return
 }
 
-func (c *Checkrr) deleteFile(path string, reason string) {
+func (c *Checkrr) deleteFile(file *FileContext, verdict Verdict) {
+	path := file.Path
+	if c.dryRun {
+		c.dryRunFile(file, verdict)
+		return
+	}
+	action := c.action
+	if verdict.Action != "" {
+		action = verdict.Action
+	}
+	if action == "quarantine" {
+		if c.quarantinePath == "" {
+			// asked for quarantine, deleting it through an arr instead would lose the file
+			c.recordBadFile(path, "flagged", verdict)
+			return
+		}
+		c.quarantineFile(file, verdict)
+		return
+	}
 	title := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
 		MessageID: "NotificationsReacquireTitle",
 	})
 	for _, sonarr := range c.sonarr {
-		if sonarr.Process && sonarr.MatchPath(path) {
+		if sonarr.Process && file.Profile.usesArr(sonarr.Name) && sonarr.MatchPath(path) {
 			sonarr.RemoveFile(path)
 			desc := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
 				MessageID: "NotificationsReacquireDesc",
@@ -690,14 +901,13 @@ func (c *Checkrr) deleteFile(path string, reason string) {
 				},
 			})
 			c.notifications.Notify(title, desc, "reacquire", path)
-			c.Stats.SonarrSubmissions++
-			c.Stats.Write("Sonarr", c.Stats.SonarrSubmissions)
-			c.recordBadFile(path, "sonarr", reason)
+			c.count(file.Ctx, "Sonarr")
+			c.recordBadFile(path, "sonarr", verdict)
 			return
 		}
 	}
 	for _, radarr := range c.radarr {
-		if radarr.Process && radarr.MatchPath(path) {
+		if radarr.Process && file.Profile.usesArr(radarr.Name) && radarr.MatchPath(path) {
 			radarr.RemoveFile(path)
 			desc := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
 				MessageID: "NotificationsReacquireDesc",
@@ -707,14 +917,13 @@ func (c *Checkrr) deleteFile(path string, reason string) {
 				},
 			})
 			c.notifications.Notify(title, desc, "reacquire", path)
-			c.Stats.RadarrSubmissions++
-			c.Stats.Write("Radarr", c.Stats.RadarrSubmissions)
-			c.recordBadFile(path, "radarr", reason)
+			c.count(file.Ctx, "Radarr")
+			c.recordBadFile(path, "radarr", verdict)
 			return
 		}
 	}
 	for _, lidarr := range c.lidarr {
-		if lidarr.Process && lidarr.MatchPath(path) {
+		if lidarr.Process && file.Profile.usesArr(lidarr.Name) && lidarr.MatchPath(path) {
 			lidarr.RemoveFile(path)
 			desc := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
 				MessageID: "NotificationsReacquireDesc",
@@ -724,9 +933,24 @@ func (c *Checkrr) deleteFile(path string, reason string) {
 				},
 			})
 			c.notifications.Notify(title, desc, "reacquire", path)
-			c.Stats.LidarrSubmissions++
-			c.Stats.Write("Lidarr", c.Stats.LidarrSubmissions)
-			c.recordBadFile(path, "lidarr", reason)
+			c.count(file.Ctx, "Lidarr")
+			c.recordBadFile(path, "lidarr", verdict)
+			return
+		}
+	}
+	for _, readarr := range c.readarr {
+		if readarr.Process && file.Profile.usesArr(readarr.Name) && readarr.MatchPath(path) {
+			readarr.RemoveFile(path)
+			desc := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "NotificationsReacquireDesc",
+				TemplateData: map[string]interface{}{
+					"Path":    path,
+					"Service": "readarr",
+				},
+			})
+			c.notifications.Notify(title, desc, "reacquire", path)
+			c.count(file.Ctx, "Readarr")
+			c.recordBadFile(path, "readarr", verdict)
 			return
 		}
 	}
@@ -737,13 +961,82 @@ func (c *Checkrr) deleteFile(path string, reason string) {
 		},
 	})
 	c.Logger.WithFields(log.Fields{"Unknown File": true}).Info(message)
-	c.recordBadFile(path, "unknown", reason)
+	c.recordBadFile(path, "unknown", verdict)
+}
+
+// dryRunFile works out where a bad file would have been sent and records that without touching the file or any arr
+// service.
+func (c *Checkrr) dryRunFile(file *FileContext, verdict Verdict) {
+	path := file.Path
+	service := "unknown"
+	action := c.action
+	if verdict.Action != "" {
+		action = verdict.Action
+	}
+	if action == "quarantine" {
+		service = "quarantine"
+		if c.quarantinePath == "" {
+			service = "flagged"
+		}
+	} else {
+		for _, sonarr := range c.sonarr {
+			if service == "unknown" && sonarr.Process && file.Profile.usesArr(sonarr.Name) && sonarr.MatchPath(path) {
+				service = "sonarr"
+			}
+		}
+		for _, radarr := range c.radarr {
+			if service == "unknown" && radarr.Process && file.Profile.usesArr(radarr.Name) && radarr.MatchPath(path) {
+				service = "radarr"
+			}
+		}
+		for _, lidarr := range c.lidarr {
+			if service == "unknown" && lidarr.Process && file.Profile.usesArr(lidarr.Name) && lidarr.MatchPath(path) {
+				service = "lidarr"
+			}
+		}
+		for _, readarr := range c.readarr {
+			if service == "unknown" && readarr.Process && file.Profile.usesArr(readarr.Name) && readarr.MatchPath(path) {
+				service = "readarr"
+			}
+		}
+	}
+
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckDryRun",
+		TemplateData: map[string]interface{}{
+			"Path":   path,
+			"Marker": dryRunMarker(service),
+			"Reason": verdict.Reason,
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Dry Run": true, "Service": service}).Info(message)
+	c.recordBadFile(path, service, verdict)
 }
 
-func (c *Checkrr) recordBadFile(path string, fileType string, reason string) {
+// dryRunMarker describes what would have happened to a bad file if dry run was off
+func dryRunMarker(service string) string {
+	switch service {
+	case "unknown":
+		return "would have been left in place, no service matched"
+	case "quarantine":
+		return "would have been quarantined"
+	case "renamed":
+		return "would have been renamed"
+	case "stripped":
+		return "would have had streams stripped"
+	case "flagged":
+		return "would have been flagged"
+	case "subtitle":
+		return "would have been reported only"
+	default:
+		return fmt.Sprintf("would have reacquired via %s", service)
+	}
+}
+
+func (c *Checkrr) recordBadFile(path string, fileType string, verdict Verdict) {
 
 	bad := BadFile{}
-	if fileType != "unknown" {
+	if !slices.Contains([]string{"unknown", "quarantine", "repaired", "stripped", "flagged", "renamed", "subtitle"}, fileType) {
 		bad.Reacquire = true
 	} else {
 		bad.Reacquire = false
@@ -752,7 +1045,13 @@ func (c *Checkrr) recordBadFile(path string, fileType string, reason string) {
 	bad.Service = fileType
 	bad.FileExt = filepath.Ext(path)
 	bad.Date = time.Now().UTC().Unix() // put this in UTC for the webui to render in local later
-	bad.Reason = reason
+	bad.Reason = verdict.Reason
+	bad.Check = verdict.Check
+	bad.Details = verdict.Details
+	if c.dryRun {
+		bad.Reacquire = false
+		bad.DryRun = dryRunMarker(fileType)
+	}
 
 	err := c.DB.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte("Checkrr-files"))
@@ -775,7 +1074,11 @@ func (c *Checkrr) recordBadFile(path string, fileType string, reason string) {
 	}
 	if len(c.config.String("csvfile")) > 0 {
 		log.Debug("writing bad file to csv")
-		c.csv.Write(path, fileType)
+		if c.dryRun {
+			c.csv.Write(path, bad.DryRun)
+		} else {
+			c.csv.Write(path, fileType)
+		}
 	}
 }
 
@@ -802,11 +1105,22 @@ func runFFmpeg(ctx context.Context, args []string) (string, error) {
 }
 
 type BadFile struct {
-	FileExt   string `json:"fileExt"`
-	Reacquire bool   `json:"reacquire"`
-	Service   string `json:"service"`
-	Date      int64  `json:"date"`
-	Reason    string `json:"reason"`
+	FileExt   string                 `json:"fileExt"`
+	Reacquire bool                   `json:"reacquire"`
+	Service   string                 `json:"service"`
+	Date      int64                  `json:"date"`
+	Reason    string                 `json:"reason"`
+	Check     string                 `json:"check,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	DryRun    string                 `json:"dryRun,omitempty"`
+}
+
+// newSlots builds a semaphore with room for size holders, falling back to def when size isn't set
+func newSlots(size int, def int) chan struct{} {
+	if size <= 0 {
+		size = def
+	}
+	return make(chan struct{}, size)
 }
 
 // TODO: if h2non/filetype#120 ever gets completed, remove this logic
@@ -0,0 +1,218 @@
+package check
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/h2non/filetype"
+	"github.com/knadh/koanf/v2"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	RegisterChecker("container", func(c *Checkrr) Checker { return &containerChecker{c: c} })
+}
+
+// containers maps each container to the extensions files in it can have. The first extension is the one a
+// mismatched file is renamed to.
+var containers = map[string][]string{
+	"matroska": {".mkv", ".mka", ".mks", ".mk3d", ".webm"},
+	"mp4":      {".mp4", ".m4v", ".m4a", ".m4b", ".mov", ".3gp", ".3g2", ".mj2", ".f4v"},
+	"mpegts":   {".ts", ".m2ts", ".mts", ".m2t", ".tp", ".trp"},
+	"avi":      {".avi", ".divx"},
+	"asf":      {".wmv", ".wma", ".asf"},
+	"flv":      {".flv"},
+	"mpeg":     {".mpg", ".mpeg", ".mpe", ".m2v", ".vob"},
+	"mp3":      {".mp3"},
+	"flac":     {".flac"},
+	"ogg":      {".ogg", ".oga", ".ogv", ".ogm", ".opus"},
+	"wav":      {".wav"},
+	"aiff":     {".aiff", ".aif"},
+	"aac":      {".aac"},
+	"ape":      {".ape"},
+	"wv":       {".wv"},
+	"rm":       {".rm", ".rmvb", ".ra"},
+}
+
+// probeContainers maps the first name in ffprobe's format_name to a container
+var probeContainers = map[string]string{
+	"matroska":  "matroska",
+	"mov":       "mp4",
+	"mpegts":    "mpegts",
+	"avi":       "avi",
+	"asf":       "asf",
+	"flv":       "flv",
+	"mpeg":      "mpeg",
+	"mpegvideo": "mpeg",
+	"mp3":       "mp3",
+	"flac":      "flac",
+	"ogg":       "ogg",
+	"wav":       "wav",
+	"aiff":      "aiff",
+	"aac":       "aac",
+	"ape":       "ape",
+	"wv":        "wv",
+	"rm":        "rm",
+}
+
+// containerChecker compares the container a file really is, from ffprobe or failing that its magic bytes, with its
+// extension. Containers or extensions it doesn't know about are left alone.
+type containerChecker struct {
+	c *Checkrr
+}
+
+func (cc *containerChecker) Name() string {
+	return "container"
+}
+
+func (cc *containerChecker) Check(file *FileContext) Verdict {
+	c := cc.c
+	ext := strings.ToLower(filepath.Ext(file.Path))
+	expected := containerFor(ext)
+	if expected == "" {
+		return Verdict{Result: Pass}
+	}
+
+	action := file.Profile.containerAction
+
+	detected, source := "", ""
+	if file.Probe != nil && file.Probe.Format != nil {
+		detected, source = probeContainers[strings.Split(file.Probe.Format.FormatName, ",")[0]], "ffprobe"
+	}
+	if detected == "" && file.Header != nil {
+		if kind, err := filetype.Match(file.Header); err == nil && kind != filetype.Unknown {
+			detected, source = containerFor("."+kind.Extension), "filetype"
+		}
+	}
+	if detected == "" || detected == expected {
+		return Verdict{Result: Pass}
+	}
+
+	newExt := containers[detected][0]
+	// mp4 audio is usually named m4a
+	if detected == "mp4" && file.Type == "Audio" {
+		newExt = ".m4a"
+	}
+	details := map[string]interface{}{"extension": ext, "container": detected, "detectedby": source}
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckContainerMismatch",
+		TemplateData: map[string]interface{}{
+			"Path":      file.Path,
+			"Container": detected,
+			"Extension": ext,
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Type": file.Type, "Container": detected, "Action": action}).Info(message)
+
+	verdict := Verdict{Result: Fail, Check: "container", Reason: "container mismatch", Details: details}
+	switch action {
+	case "rename":
+		renamed, err := c.renameExtension(file.Path, newExt)
+		if err != nil {
+			message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "CheckRenameFailed",
+				TemplateData: map[string]interface{}{
+					"Path":  file.Path,
+					"Error": err.Error(),
+				},
+			})
+			c.Logger.WithFields(log.Fields{"Type": file.Type, "Container": detected}).Warn(message)
+			c.recordBadFile(file.Path, "flagged", verdict)
+			return Verdict{Result: Pass}
+		}
+		details["renamed"] = renamed
+		c.recordBadFile(file.Path, "renamed", verdict)
+		if !c.dryRun {
+			if err := c.moveRecord(file.Path, renamed); err != nil {
+				c.logRecordError(renamed, err)
+			}
+			file.Path = renamed
+			if file.Probe != nil && file.Probe.Format != nil {
+				file.Probe.Format.Filename = renamed
+			}
+			c.rescanArr(file)
+		}
+		return Verdict{Result: Pass}
+	case "reacquire", "quarantine":
+		return Verdict{Result: Fail, Reason: verdict.Reason, Details: details, Action: action}
+	default:
+		c.recordBadFile(file.Path, "flagged", verdict)
+		return Verdict{Result: Pass}
+	}
+}
+
+// containerAction reads containeraction, falling back to flag for values it doesn't know and for quarantine without
+// a quarantinepath, so a mismatch is never sent off to be reacquired by mistake
+func (c *Checkrr) containerAction(conf *koanf.Koanf) string {
+	action := conf.String("containeraction")
+	switch action {
+	case "":
+		return "flag"
+	case "flag", "rename", "reacquire":
+		return action
+	case "quarantine":
+		if conf.String("quarantinepath") != "" {
+			return action
+		}
+	}
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckContainerBadAction",
+		TemplateData: map[string]interface{}{
+			"Action": action,
+		},
+	})
+	c.Logger.WithFields(log.Fields{"startup": true}).Warn(message)
+	return "flag"
+}
+
+// rescanArr tells the arr that manages a renamed file to rescan, so it picks up the new name instead of reporting
+// the file missing
+func (c *Checkrr) rescanArr(file *FileContext) {
+	for _, sonarr := range c.sonarr {
+		if sonarr.Process && file.Profile.usesArr(sonarr.Name) && sonarr.MatchPath(file.Path) && sonarr.Rescan(file.Path) {
+			return
+		}
+	}
+	for _, radarr := range c.radarr {
+		if radarr.Process && file.Profile.usesArr(radarr.Name) && radarr.MatchPath(file.Path) && radarr.Rescan(file.Path) {
+			return
+		}
+	}
+	for _, lidarr := range c.lidarr {
+		if lidarr.Process && file.Profile.usesArr(lidarr.Name) && lidarr.MatchPath(file.Path) && lidarr.Rescan(file.Path) {
+			return
+		}
+	}
+	for _, readarr := range c.readarr {
+		if readarr.Process && file.Profile.usesArr(readarr.Name) && readarr.MatchPath(file.Path) && readarr.Rescan(file.Path) {
+			return
+		}
+	}
+}
+
+// renameExtension swaps a file's extension for ext, refusing to overwrite anything already at the new name. In
+// dry run it only works out the new name.
+func (c *Checkrr) renameExtension(path string, ext string) (string, error) {
+	renamed := strings.TrimSuffix(path, filepath.Ext(path)) + ext
+	if _, err := os.Lstat(renamed); err == nil {
+		return renamed, errors.New("a file with the new name already exists")
+	}
+	if c.dryRun {
+		return renamed, nil
+	}
+	return renamed, os.Rename(path, renamed)
+}
+
+func containerFor(ext string) string {
+	for container, exts := range containers {
+		for _, e := range exts {
+			if e == ext {
+				return container
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,191 @@
+package check
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kalafut/imohash"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// deepScanDefaultTime is the budget a deep scan gets when neither maxtime nor maxgb is set, so a run never turns
+// into decoding the whole library
+const deepScanDefaultTime = time.Hour
+
+// deepScanCandidate is a known good file that could be decoded again
+type deepScanCandidate struct {
+	path   string
+	record FileRecord
+}
+
+// deepScan runs the ffmpeg-full stage over the files that have gone longest without one, until the run's maxtime or
+// maxgb budget is used up. Over enough runs the whole library gets decoded without any one run taking days.
+func (c *Checkrr) deepScan(ctx context.Context) {
+	conf := c.config.Cut("deepscan")
+	if !conf.Bool("enabled") || ctx.Err() != nil {
+		return
+	}
+	maxTime := conf.Duration("maxtime")
+	maxBytes := int64(conf.Float64("maxgb") * 1e9)
+	if maxTime <= 0 && maxBytes <= 0 {
+		maxTime = deepScanDefaultTime
+	}
+
+	candidates, err := c.deepScanCandidates()
+	if err != nil {
+		c.logRecordError("deepscan", err)
+		return
+	}
+
+	// pick files oldest deep check first, files that never had one before anything else, until the byte budget is hit
+	var picked []deepScanCandidate
+	var total int64
+	for _, candidate := range candidates {
+		if maxBytes > 0 && len(picked) > 0 && total+candidate.record.Size > maxBytes {
+			break
+		}
+		picked = append(picked, candidate)
+		total += candidate.record.Size
+	}
+	if len(picked) == 0 {
+		return
+	}
+
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckDeepScanStart",
+		TemplateData: map[string]interface{}{
+			"Count": len(picked),
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Deep Scan": true}).Info(message)
+
+	deadline := time.Now().Add(maxTime)
+	checker := &ffmpegChecker{c: c}
+	files := make(chan deepScanCandidate)
+	wg := &sync.WaitGroup{}
+	scanned := 0
+	var scannedLock sync.Mutex
+	for i := 0; i < cap(c.ffmpegSlots); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for candidate := range files {
+				if c.deepScanFile(ctx, checker, candidate) {
+					scannedLock.Lock()
+					scanned++
+					scannedLock.Unlock()
+				}
+			}
+		}()
+	}
+	for _, candidate := range picked {
+		// files already being decoded are allowed to finish, we just don't start any more
+		if ctx.Err() != nil || (maxTime > 0 && time.Now().After(deadline)) {
+			break
+		}
+		files <- candidate
+	}
+	close(files)
+	wg.Wait()
+
+	message = c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckDeepScanDone",
+		TemplateData: map[string]interface{}{
+			"Count": scanned,
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Deep Scan": true}).Info(message)
+}
+
+// deepScanFile decodes a single file, reporting whether it passed
+func (c *Checkrr) deepScanFile(ctx context.Context, checker *ffmpegChecker, candidate deepScanCandidate) bool {
+	path := candidate.path
+	info, err := os.Stat(path)
+	if err != nil || !candidate.record.unchanged(info) {
+		// gone or changed since it was last checked, the next run takes care of it
+		return false
+	}
+
+	c.Logger.WithFields(log.Fields{"Deep Scan": true}).Debugf("\"%s\"", path)
+	file := &FileContext{Ctx: ctx, Path: path, Root: c.rootFor(path), Profile: c.profileOf(path)}
+	verdict := checker.Check(file)
+	if ctx.Err() != nil {
+		return false
+	}
+	switch verdict.Result {
+	case Fail:
+		verdict.Check = "deepscan"
+		if c.repairFile(file, verdict, []Checker{checker}) {
+			// the file changed, so it needs a fresh record
+			sum, err := imohash.SumFile(path)
+			if err == nil {
+				err = c.storeRecord(ctx, path, sum)
+			}
+			if err != nil {
+				c.logRecordError(path, err)
+			}
+			return true
+		}
+		c.deleteFile(file, verdict)
+		return false
+	case Inconclusive:
+		return false
+	}
+
+	record := candidate.record
+	record.DeepChecked = time.Now().UTC().Unix()
+	err = c.putRecord(path, &record)
+	if err != nil {
+		c.logRecordError(path, err)
+	}
+	return true
+}
+
+// deepScanCandidates lists the recorded files under the checkpaths of the current run, least recently deep checked
+// first
+func (c *Checkrr) deepScanCandidates() ([]deepScanCandidate, error) {
+	var candidates []deepScanCandidate
+	err := c.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("Checkrr")).ForEach(func(k, v []byte) error {
+			path := string(k)
+			// subtitles have nothing for ffmpeg to decode
+			if !c.inRun(path) || c.ignored(path) || c.isSubtitle(path) {
+				return nil
+			}
+			record := FileRecord{}
+			if json.Unmarshal(v, &record) != nil {
+				// old raw hash, it becomes a record once the file has been seen again
+				return nil
+			}
+			candidates = append(candidates, deepScanCandidate{path: path, record: record})
+			return nil
+		})
+	})
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i].record, candidates[j].record
+		if a.DeepChecked != b.DeepChecked {
+			return a.DeepChecked < b.DeepChecked
+		}
+		return strings.Compare(candidates[i].path, candidates[j].path) < 0
+	})
+	return candidates, err
+}
+
+// inRun reports whether a path is under one of the checkpaths the current run walks
+func (c *Checkrr) inRun(path string) bool {
+	for _, root := range c.roots {
+		rel, err := filepath.Rel(root, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
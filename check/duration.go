@@ -0,0 +1,87 @@
+package check
+
+import (
+	"time"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	RegisterChecker("duration", func(c *Checkrr) Checker { return &durationChecker{c: c} })
+}
+
+// durationChecker fails files that are much shorter than the runtime the matching arr service expects, which is
+// how a truncated download that still probes fine shows up. It needs the ffprobe stage to run before it.
+type durationChecker struct {
+	c *Checkrr
+}
+
+func (d *durationChecker) Name() string {
+	return "duration"
+}
+
+func (d *durationChecker) Check(file *FileContext) Verdict {
+	c := d.c
+	data := file.Probe
+	minPercent := file.Profile.config.Float64("mindurationpercent")
+	if data == nil || data.Format == nil || minPercent <= 0 {
+		return Verdict{Result: Pass}
+	}
+
+	expected, service, ok := c.expectedRuntime(file)
+	if !ok {
+		return Verdict{Result: Pass}
+	}
+	actual := time.Duration(data.Format.DurationSeconds * float64(time.Second))
+	if actual.Seconds() >= expected.Seconds()*minPercent/100 {
+		return Verdict{Result: Pass}
+	}
+
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckTruncated",
+		TemplateData: map[string]interface{}{
+			"Path":     file.Path,
+			"Actual":   actual.Round(time.Second).String(),
+			"Expected": expected.Round(time.Second).String(),
+			"Service":  service,
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Type": file.Type, "Truncated": true}).Info(message)
+	return Verdict{Result: Fail, Reason: "truncated", Details: map[string]interface{}{
+		"expected": expected.Round(time.Second).String(),
+		"actual":   actual.Round(time.Second).String(),
+		"service":  service,
+	}}
+}
+
+// expectedRuntime asks the connected arr services, in the same order deleteFile does, for the runtime of the
+// episode, movie or track a file holds
+func (c *Checkrr) expectedRuntime(file *FileContext) (time.Duration, string, bool) {
+	path := file.Path
+	for _, sonarr := range c.sonarr {
+		if !sonarr.Process || !file.Profile.usesArr(sonarr.Name) {
+			continue
+		}
+		if runtime, ok := sonarr.ExpectedRuntime(path); ok {
+			return runtime, "sonarr", true
+		}
+	}
+	for _, radarr := range c.radarr {
+		if !radarr.Process || !file.Profile.usesArr(radarr.Name) {
+			continue
+		}
+		if runtime, ok := radarr.ExpectedRuntime(path); ok {
+			return runtime, "radarr", true
+		}
+	}
+	for _, lidarr := range c.lidarr {
+		if !lidarr.Process || !file.Profile.usesArr(lidarr.Name) {
+			continue
+		}
+		if runtime, ok := lidarr.ExpectedRuntime(path); ok {
+			return runtime, "lidarr", true
+		}
+	}
+	return 0, "", false
+}
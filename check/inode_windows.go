@@ -0,0 +1,10 @@
+//go:build windows
+
+package check
+
+import "os"
+
+// inode is always 0 on windows, where FileInfo doesn't carry a file index
+func inode(info os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,115 @@
+package check
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+)
+
+// queuedRefresh is how long the arr download queues are trusted before they are fetched again during a run
+const queuedRefresh = 5 * time.Minute
+
+// tooNew reports whether a file was modified more recently than the minfileage of its checkpath. Files that are
+// still being copied or moved into place would otherwise fail ffprobe and get thrown away.
+func (c *Checkrr) tooNew(path string, d fs.DirEntry) bool {
+	minAge := c.profileOf(path).config.Duration("minfileage")
+	if minAge <= 0 {
+		return false
+	}
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+	age := time.Since(info.ModTime())
+	if age >= minAge {
+		return false
+	}
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckSkippedTooNew",
+		TemplateData: map[string]interface{}{
+			"Path": path,
+			"Age":  age.Round(time.Second).String(),
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Skipped": true, "MinFileAge": minAge.String()}).Info(message)
+	return true
+}
+
+// queued reports whether a file or directory is part of an active download or import in one of the connected arr
+// services, when skipqueued is set. The queues are fetched at the start of a run and again every queuedRefresh.
+func (c *Checkrr) queued(path string) bool {
+	if !c.config.Bool("skipqueued") {
+		return false
+	}
+	if time.Since(c.queuedAt) > queuedRefresh {
+		c.refreshQueued()
+	}
+	for _, queuedPath := range c.queuedPaths {
+		rel, err := filepath.Rel(queuedPath, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "CheckSkippedQueued",
+			TemplateData: map[string]interface{}{
+				"Path": path,
+			},
+		})
+		c.Logger.WithFields(log.Fields{"Skipped": true, "Queued": queuedPath}).Info(message)
+		return true
+	}
+	return false
+}
+
+func (c *Checkrr) refreshQueued() {
+	var paths []string
+	for _, sonarr := range c.sonarr {
+		if sonarr.Process {
+			queued, err := sonarr.QueuedPaths()
+			c.logQueueError(sonarr.Name, err)
+			paths = append(paths, queued...)
+		}
+	}
+	for _, radarr := range c.radarr {
+		if radarr.Process {
+			queued, err := radarr.QueuedPaths()
+			c.logQueueError(radarr.Name, err)
+			paths = append(paths, queued...)
+		}
+	}
+	for _, lidarr := range c.lidarr {
+		if lidarr.Process {
+			queued, err := lidarr.QueuedPaths()
+			c.logQueueError(lidarr.Name, err)
+			paths = append(paths, queued...)
+		}
+	}
+	for _, readarr := range c.readarr {
+		if readarr.Process {
+			queued, err := readarr.QueuedPaths()
+			c.logQueueError(readarr.Name, err)
+			paths = append(paths, queued...)
+		}
+	}
+	c.queuedPaths = paths
+	c.queuedAt = time.Now()
+	c.Logger.WithFields(log.Fields{"Queued": len(paths)}).Debugf("arr queue paths: %v", paths)
+}
+
+func (c *Checkrr) logQueueError(service string, err error) {
+	if err == nil {
+		return
+	}
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "ArrQueueError",
+		TemplateData: map[string]interface{}{
+			"Service": service,
+			"Error":   err.Error(),
+		},
+	})
+	c.Logger.Warn(message)
+}
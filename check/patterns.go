@@ -0,0 +1,113 @@
+package check
+
+import (
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+)
+
+// pathPattern is an ignorepaths or includepaths entry. Entries starting with regex: are regular expressions,
+// anything else is a doublestar glob. Both are matched against the path relative to the checkpath, with forward
+// slashes. Globs without a slash match a single file or directory name at any depth, and absolute globs match the
+// full path, like the plain paths ignorepaths used to take.
+type pathPattern struct {
+	raw      string
+	glob     string
+	re       *regexp.Regexp
+	absolute bool
+	nameOnly bool
+}
+
+// compilePatterns turns config entries into patterns, warning about and skipping any that don't parse
+func (c *Checkrr) compilePatterns(entries []string) []pathPattern {
+	var patterns []pathPattern
+	for _, entry := range entries {
+		if entry == "" {
+			continue
+		}
+		p := pathPattern{raw: entry}
+		var err error
+		if expr, ok := strings.CutPrefix(entry, "regex:"); ok {
+			p.re, err = regexp.Compile(expr)
+		} else {
+			p.glob = filepath.ToSlash(entry)
+			p.absolute = strings.HasPrefix(p.glob, "/") || filepath.IsAbs(entry)
+			p.glob = strings.TrimSuffix(p.glob, "/")
+			if !p.absolute {
+				p.glob = strings.TrimPrefix(p.glob, "./")
+				p.nameOnly = !strings.Contains(p.glob, "/")
+			}
+			if !doublestar.ValidatePattern(p.glob) {
+				err = doublestar.ErrBadPattern
+			}
+		}
+		if err != nil {
+			message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "CheckBadPattern",
+				TemplateData: map[string]interface{}{
+					"Pattern": entry,
+					"Error":   err.Error(),
+				},
+			})
+			c.Logger.WithFields(log.Fields{"startup": true}).Warn(message)
+			continue
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns
+}
+
+// match tests a single file or directory, abs is its full path and rel the path relative to the checkpath
+func (p pathPattern) match(abs string, rel string) bool {
+	if p.re != nil {
+		return p.re.MatchString(rel)
+	}
+	target := rel
+	if p.absolute {
+		target = abs
+	} else if p.nameOnly {
+		target = path.Base(rel)
+	}
+	// plain paths can hold glob characters, like the brackets in "Show [2019]"
+	if p.absolute && target == p.glob {
+		return true
+	}
+	matched, _ := doublestar.Match(p.glob, target)
+	return matched
+}
+
+// matchPatterns reports whether any pattern matches the path or one of its directories under root, so a pattern
+// matching a directory covers everything in it
+func matchPatterns(patterns []pathPattern, root string, file string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+	abs := filepath.ToSlash(file)
+	rel := relativeTo(root, file)
+	for rel != "" && rel != "." {
+		for _, p := range patterns {
+			if p.match(abs, rel) {
+				return true
+			}
+		}
+		rel, abs = path.Dir(rel), path.Dir(abs)
+	}
+	return false
+}
+
+// relativeTo is file relative to root with forward slashes. Files outside every checkpath use their full path
+// without the leading slash.
+func relativeTo(root string, file string) string {
+	if root != "" {
+		rel, err := filepath.Rel(root, file)
+		if err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return strings.TrimPrefix(filepath.ToSlash(filepath.Clean(file)), "/")
+}
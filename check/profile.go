@@ -0,0 +1,262 @@
+package check
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/knadh/koanf/v2"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+)
+
+// PathProfile is the settings a checkpath is checked with. A checkpath given as a plain string uses the top level
+// checkrr settings. One given as an object can override any of the check, rules, ignore and remove settings, and
+// adds its own cron and the arr services files under it are sent to.
+type PathProfile struct {
+	Path string
+	// Cron is the schedule for this path, empty to follow the top level cron
+	Cron string
+	// Arr names the arr entries files under this path can be sent to, empty for all of them
+	Arr []string
+
+	// root is the checkpath ignore and include patterns are relative to. It is Path, except for profiles made from
+	// the deprecated pathchecks, which keep the root of the checkpath they are in.
+	root         string
+	config       *koanf.Koanf
+	ignoreExts   []string
+	ignorePaths  []pathPattern
+	includePaths []pathPattern
+	ignoreHidden bool
+	removeVideo  []string
+	removeAudio  []string
+	removeLang   []string
+	stripAudio   bool
+	stripLang    bool
+	// containerAction is flag, rename, reacquire or quarantine
+	containerAction string
+	rules           []Rule
+	checkers        []Checker
+}
+
+// checkpaths lists the configured checkpaths, whether they are given as strings or objects
+func (c *Checkrr) checkpaths() []string {
+	var paths []string
+	for _, entry := range c.checkpathEntries() {
+		paths = append(paths, entry.String("path"))
+	}
+	return paths
+}
+
+// checkpathEntries turns each checkpath into its own config, plain string entries only have a path
+func (c *Checkrr) checkpathEntries() []*koanf.Koanf {
+	return checkpathEntries(c.config)
+}
+
+func checkpathEntries(conf *koanf.Koanf) []*koanf.Koanf {
+	raw, ok := conf.Get("checkpath").([]interface{})
+	if !ok {
+		var entries []*koanf.Koanf
+		for _, path := range conf.Strings("checkpath") {
+			entry := koanf.New(".")
+			_ = entry.Set("path", path)
+			entries = append(entries, entry)
+		}
+		return entries
+	}
+
+	objects := conf.Slices("checkpath")
+	var entries []*koanf.Koanf
+	for _, v := range raw {
+		if _, isObject := v.(map[string]interface{}); isObject {
+			// Slices keeps the objects in order and skips everything else
+			entry := objects[0]
+			objects = objects[1:]
+			if entry.String("path") != "" {
+				entries = append(entries, entry)
+			}
+			continue
+		}
+		if path, isString := v.(string); isString && path != "" {
+			entry := koanf.New(".")
+			_ = entry.Set("path", path)
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// loadProfiles builds a profile for each checkpath and the default profile for files outside all of them
+func (c *Checkrr) loadProfiles() {
+	scripts := c.registerScripts()
+	c.defaults = c.newProfile("", c.config, scripts)
+	c.profiles = nil
+	for _, entry := range c.checkpathEntries() {
+		var profile *PathProfile
+		if len(entry.Keys()) > 1 {
+			// anything besides the path overrides the top level settings
+			conf := c.config.Copy()
+			_ = conf.Merge(entry)
+			profile = c.newProfile(entry.String("path"), conf, scripts)
+		} else {
+			defaults := *c.defaults
+			profile = &defaults
+			profile.Path = entry.String("path")
+		}
+		profile.root = profile.Path
+		profile.Cron = entry.String("cron")
+		profile.Arr = entry.Strings("arr")
+		c.profiles = append(c.profiles, profile)
+	}
+	c.loadPathchecks()
+}
+
+// loadPathchecks turns each pathchecks entry into a profile like the one of the checkpath it is in, with its own
+// checks. pathchecks predates checkpath objects, which can set checks for a folder themselves.
+func (c *Checkrr) loadPathchecks() {
+	for _, conf := range c.config.Slices("pathchecks") {
+		path := conf.String("path")
+		if path == "" {
+			continue
+		}
+		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "CheckPathchecksDeprecated",
+			TemplateData: map[string]interface{}{
+				"Path": path,
+			},
+		})
+		c.Logger.WithFields(log.Fields{"startup": true}).Warn(message)
+
+		path = filepath.Clean(path)
+		parent := c.profileOf(path)
+		checkers := c.buildCheckers(conf.Strings("checks"))
+		if parent != c.defaults && filepath.Clean(parent.Path) == path {
+			parent.checkers = checkers
+			continue
+		}
+		profile := *parent
+		profile.Path = path
+		profile.checkers = checkers
+		c.profiles = append(c.profiles, &profile)
+	}
+}
+
+func (c *Checkrr) newProfile(path string, conf *koanf.Koanf, scripts []string) *PathProfile {
+	p := &PathProfile{
+		Path:         path,
+		config:       conf,
+		ignoreExts:   conf.Strings("ignoreexts"),
+		ignorePaths:  c.compilePatterns(conf.Strings("ignorepaths")),
+		includePaths: c.compilePatterns(conf.Strings("includepaths")),
+		ignoreHidden: conf.Bool("ignorehidden"),
+		removeVideo:  conf.Strings("removevideo"),
+		removeAudio:  conf.Strings("removeaudio"),
+		removeLang:   conf.Strings("removelang"),
+		stripAudio:   conf.String("removeaudioaction") == "strip",
+		stripLang:    conf.String("removelangaction") == "strip",
+		rules:        c.loadRules(conf),
+	}
+
+	checks := conf.Strings("checks")
+	if len(checks) == 0 {
+		checks = append(c.defaultChecks(conf), scripts...)
+	}
+	p.checkers = c.buildCheckers(checks)
+	p.containerAction = c.containerAction(conf)
+
+	// warn if ffprobe is disabled and defined flags need it
+	if !slices.Contains(checks, "ffprobe") {
+		fields := log.Fields{"startup": true}
+		if path != "" {
+			fields["path"] = path
+		}
+		if len(p.removeVideo) > 0 {
+			c.Logger.WithFields(fields).Warn("remove video flag is set, but ffprobe is disabled. codec based removal will not run")
+		}
+		if len(p.removeAudio) > 0 {
+			c.Logger.WithFields(fields).Warn("remove audio flag is set, but ffprobe is disabled. codec based removal will not run")
+		}
+		if len(p.removeLang) > 0 {
+			c.Logger.WithFields(fields).Warn("remove language flag is set, but ffprobe is disabled. codec based removal will not run")
+		}
+		if conf.Bool("requireaudio") {
+			c.Logger.WithFields(fields).Warn("require audio flag is set, but ffprobe is disabled. codec based removal will not run")
+		}
+	}
+	return p
+}
+
+// profileOf returns the profile of the checkpath that contains path, the most specific one if they nest. Files
+// outside every checkpath, like arr imports to a folder checkrr doesn't scan, get the top level settings.
+func (c *Checkrr) profileOf(path string) *PathProfile {
+	profile := c.defaults
+	longest := -1
+	for _, p := range c.profiles {
+		rel, err := filepath.Rel(p.Path, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if len(p.Path) > longest {
+			longest = len(p.Path)
+			profile = p
+		}
+	}
+	return profile
+}
+
+// patternRoot is the checkpath the ignore and include patterns of a file are matched relative to
+func (c *Checkrr) patternRoot(p *PathProfile, path string) string {
+	if p.root != "" {
+		return p.root
+	}
+	return c.rootFor(path)
+}
+
+// usesArr reports whether files under the profile can be sent to the named arr entry
+func (p *PathProfile) usesArr(name string) bool {
+	return p == nil || len(p.Arr) == 0 || slices.Contains(p.Arr, name)
+}
+
+// Crons lists the distinct schedules across the top level cron and every checkpath, the top level one first. It
+// reads the latest config, so it can be called right after Reload.
+func (c *Checkrr) Crons() []string {
+	conf := c.latestConfig()
+	crons := []string{conf.String("cron")}
+	for _, entry := range checkpathEntries(conf) {
+		if spec := entry.String("cron"); spec != "" && !slices.Contains(crons, spec) {
+			crons = append(crons, spec)
+		}
+	}
+	return crons
+}
+
+// ScheduledRun is a cron job that checks the checkpaths on one schedule
+type ScheduledRun struct {
+	c    *Checkrr
+	spec string
+}
+
+// Schedule returns the cron job for a schedule from Crons
+func (c *Checkrr) Schedule(spec string) *ScheduledRun {
+	return &ScheduledRun{c: c, spec: spec}
+}
+
+// Run queues a check of the checkpaths on this schedule. Checkpaths without their own cron follow the top level one.
+func (s *ScheduledRun) Run() {
+	c := s.c
+	conf := c.latestConfig()
+	var roots []string
+	for _, entry := range checkpathEntries(conf) {
+		spec := entry.String("cron")
+		if spec == "" {
+			spec = conf.String("cron")
+		}
+		if spec == s.spec {
+			roots = append(roots, entry.String("path"))
+		}
+	}
+	if len(roots) == 0 {
+		return
+	}
+	c.queueWalk(roots)
+}
@@ -0,0 +1,285 @@
+package check
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kalafut/imohash"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/vansante/go-ffprobe.v2"
+)
+
+// QuarantinedFile is the record kept for a file that was moved out of the library instead of being sent to an arr
+// service. The same data is written next to the quarantined file as a sidecar.
+type QuarantinedFile struct {
+	OriginalPath   string             `json:"originalPath"`
+	QuarantinePath string             `json:"quarantinePath"`
+	Bad            BadFile            `json:"badFile"`
+	Probe          *ffprobe.ProbeData `json:"ffprobe,omitempty"`
+}
+
+const quarantineSidecarExt = ".checkrr.json"
+
+func (c *Checkrr) quarantineFile(file *FileContext, verdict Verdict) {
+	path := file.Path
+	dest, err := c.quarantineDest(path)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(dest), 0755)
+	}
+	if err == nil {
+		err = moveFile(path, dest)
+	}
+	if err != nil {
+		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "CheckQuarantineError",
+			TemplateData: map[string]interface{}{
+				"Path":  path,
+				"Error": err.Error(),
+			},
+		})
+		c.Logger.WithFields(log.Fields{"Quarantine": false}).Error(message)
+		c.recordBadFile(path, "unknown", verdict)
+		return
+	}
+
+	record := QuarantinedFile{
+		OriginalPath:   path,
+		QuarantinePath: dest,
+		Bad: BadFile{
+			FileExt: filepath.Ext(path),
+			Service: "quarantine",
+			Date:    time.Now().UTC().Unix(),
+			Reason:  verdict.Reason,
+			Check:   verdict.Check,
+			Details: verdict.Details,
+		},
+		Probe: file.Probe,
+	}
+
+	sidecar, err := json.MarshalIndent(record, "", "  ")
+	if err == nil {
+		err = os.WriteFile(dest+quarantineSidecarExt, sidecar, 0644)
+	}
+	if err == nil {
+		err = c.DB.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte("Checkrr-quarantine"))
+			return b.Put([]byte(path), sidecar)
+		})
+	}
+	if err != nil {
+		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "CheckQuarantineError",
+			TemplateData: map[string]interface{}{
+				"Path":  path,
+				"Error": err.Error(),
+			},
+		})
+		c.Logger.WithFields(log.Fields{"Quarantine": true}).Warn(message)
+	}
+
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckQuarantined",
+		TemplateData: map[string]interface{}{
+			"Path":        path,
+			"Destination": dest,
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Quarantine": true}).Info(message)
+
+	title := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "NotificationsQuarantineTitle",
+	})
+	desc := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "NotificationsQuarantineDesc",
+		TemplateData: map[string]interface{}{
+			"Path":   path,
+			"Reason": verdict.Reason,
+		},
+	})
+	c.notifications.Notify(title, desc, "quarantine", path)
+	c.recordBadFile(path, "quarantine", verdict)
+}
+
+// QuarantinedFiles returns every file currently held in quarantine
+func (c *Checkrr) QuarantinedFiles() ([]QuarantinedFile, error) {
+	var files []QuarantinedFile
+	err := c.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("Checkrr-quarantine"))
+		return b.ForEach(func(k, v []byte) error {
+			record := QuarantinedFile{}
+			err := json.Unmarshal(v, &record)
+			if err != nil {
+				return err
+			}
+			record.Probe = nil // the sidecar keeps the full probe, no need to ship it around
+			files = append(files, record)
+			return nil
+		})
+	})
+	return files, err
+}
+
+// RestoreQuarantined moves a quarantined file back to where it was found. The file is marked as known good so the
+// next run doesn't quarantine it again.
+func (c *Checkrr) RestoreQuarantined(path string) error {
+	record, err := c.quarantineRecord(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(record.OriginalPath); err == nil {
+		return fmt.Errorf("refusing to overwrite existing file %s", record.OriginalPath)
+	}
+
+	err = os.MkdirAll(filepath.Dir(record.OriginalPath), 0755)
+	if err != nil {
+		return err
+	}
+	err = moveFile(record.QuarantinePath, record.OriginalPath)
+	if err != nil {
+		return err
+	}
+	_ = os.Remove(record.QuarantinePath + quarantineSidecarExt)
+
+	fileHash := imohash.New()
+	sum, err := fileHash.SumFile(record.OriginalPath)
+	if err != nil {
+		return err
+	}
+
+	err = c.DB.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket([]byte("Checkrr-quarantine")).Delete([]byte(path))
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("Checkrr-files")).Delete([]byte(path))
+	})
+	if err != nil {
+		return err
+	}
+	err = c.storeRecord(context.Background(), path, sum)
+	if err != nil {
+		return err
+	}
+
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "QuarantineRestored",
+		TemplateData: map[string]interface{}{
+			"Path": path,
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Quarantine": "restore"}).Info(message)
+	return nil
+}
+
+// PurgeQuarantined deletes a quarantined file and its sidecar for good
+func (c *Checkrr) PurgeQuarantined(path string) error {
+	record, err := c.quarantineRecord(path)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(record.QuarantinePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	_ = os.Remove(record.QuarantinePath + quarantineSidecarExt)
+
+	err = c.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("Checkrr-quarantine")).Delete([]byte(path))
+	})
+	if err != nil {
+		return err
+	}
+
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "QuarantinePurged",
+		TemplateData: map[string]interface{}{
+			"Path": path,
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Quarantine": "purge"}).Info(message)
+	return nil
+}
+
+func (c *Checkrr) quarantineRecord(path string) (QuarantinedFile, error) {
+	record := QuarantinedFile{}
+	err := c.DB.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte("Checkrr-quarantine")).Get([]byte(path))
+		if v == nil {
+			return fmt.Errorf("%s is not quarantined", path)
+		}
+		return json.Unmarshal(v, &record)
+	})
+	return record, err
+}
+
+// quarantineDest picks where a file goes in quarantine. It keeps the file's whole path, checkpath included, so files
+// with the same path under different checkpaths don't land on each other, and numbers the name if something is
+// already there.
+func (c *Checkrr) quarantineDest(path string) (string, error) {
+	dest := filepath.Join(c.quarantinePath, strings.TrimLeft(strings.TrimPrefix(path, filepath.VolumeName(path)), `/\`))
+	ext := filepath.Ext(dest)
+	base := strings.TrimSuffix(dest, ext)
+	for i := 1; i <= 1000; i++ {
+		if !exists(dest) && !exists(dest+quarantineSidecarExt) {
+			return dest, nil
+		}
+		dest = fmt.Sprintf("%s.%d%s", base, i, ext)
+	}
+	return "", fmt.Errorf("no free name in quarantine for %s", path)
+}
+
+// exists reports whether anything, even a broken symlink, is at path
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return !errors.Is(err, os.ErrNotExist)
+}
+
+// moveFile renames src to dst, falling back to a copy when they live on different filesystems
+func moveFile(src string, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+
+	in.Close()
+	return os.Remove(src)
+}
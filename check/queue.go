@@ -0,0 +1,115 @@
+package check
+
+import (
+	"slices"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// job is work waiting for checkrr to be free. It either walks checkpaths, like a scheduled or manual run, or checks a
+// batch of files from watch mode, an arr webhook or a suspect recheck.
+type job struct {
+	roots []string
+	files []string
+	done  []chan struct{}
+}
+
+// queueWalk queues a walk of the checkpaths. A walk that hasn't started yet takes the new checkpaths on, so schedules
+// that fire together, or while a long run is going, turn into one run instead of piling up. The returned channel is
+// closed once the walk is over.
+func (c *Checkrr) queueWalk(roots []string) <-chan struct{} {
+	done := make(chan struct{})
+	c.queueLock.Lock()
+	defer c.queueLock.Unlock()
+	if c.closed {
+		close(done)
+		return done
+	}
+	for _, j := range c.jobs {
+		if j.roots != nil {
+			for _, root := range roots {
+				if !slices.Contains(j.roots, root) {
+					j.roots = append(j.roots, root)
+				}
+			}
+			j.done = append(j.done, done)
+			return done
+		}
+	}
+	if c.draining {
+		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "CheckRunQueued",
+		})
+		c.Logger.Info(message)
+	}
+	c.jobs = append(c.jobs, &job{roots: slices.Clone(roots), done: []chan struct{}{done}})
+	c.startDrain()
+	return done
+}
+
+// Queue checks files as soon as checkrr is free. Files queued while a run is going are checked once it finishes, in
+// one batch with anything else queued in the meantime.
+func (c *Checkrr) Queue(paths []string) {
+	c.queueLock.Lock()
+	defer c.queueLock.Unlock()
+	if c.closed || len(paths) == 0 {
+		return
+	}
+	for _, j := range c.jobs {
+		if j.files != nil {
+			for _, path := range paths {
+				if !slices.Contains(j.files, path) {
+					j.files = append(j.files, path)
+				}
+			}
+			return
+		}
+	}
+	c.jobs = append(c.jobs, &job{files: slices.Clone(paths)})
+	c.startDrain()
+}
+
+// startDrain starts working through the queue if nothing is yet. It needs queueLock held.
+func (c *Checkrr) startDrain() {
+	if !c.draining {
+		c.draining = true
+		go c.drainQueue()
+	}
+}
+
+// drainQueue runs the queued jobs one at a time, in the order they were queued, until the queue is empty
+func (c *Checkrr) drainQueue() {
+	for {
+		c.queueLock.Lock()
+		if len(c.jobs) == 0 || c.closed {
+			c.draining = false
+			c.queueLock.Unlock()
+			return
+		}
+		next := c.jobs[0]
+		c.jobs = c.jobs[1:]
+		c.queueLock.Unlock()
+
+		if next.roots != nil {
+			c.run(next.roots)
+		} else {
+			c.runFiles(next.files)
+		}
+		for _, done := range next.done {
+			close(done)
+		}
+	}
+}
+
+// closeQueue drops everything still queued and stops new work from being queued, for shutdown
+func (c *Checkrr) closeQueue() {
+	c.queueLock.Lock()
+	defer c.queueLock.Unlock()
+	c.closed = true
+	for _, j := range c.jobs {
+		for _, done := range j.done {
+			close(done)
+		}
+	}
+	c.jobs = nil
+}
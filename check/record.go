@@ -0,0 +1,148 @@
+package check
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kalafut/imohash"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// FileRecord is what the Checkrr bucket keeps for every file that passed its checks. Size, ModTime and Inode let
+// unchanged files skip hashing entirely.
+type FileRecord struct {
+	Size        int64  `json:"size"`
+	ModTime     int64  `json:"mtime"`
+	Inode       uint64 `json:"inode,omitempty"`
+	Hash        string `json:"hash"`
+	LastChecked int64  `json:"lastChecked"`
+	Profile     string `json:"profile"`
+	FullHash    string `json:"fullHash,omitempty"`
+	HashAlgo    string `json:"hashAlgo,omitempty"`
+	Verified    int64  `json:"verified,omitempty"`
+	DeepChecked int64  `json:"deepChecked,omitempty"`
+	// legacy is set for entries written by older versions, which only stored the raw imohash
+	legacy bool
+}
+
+// unchanged reports whether the file on disk still looks like the one that was recorded
+func (r FileRecord) unchanged(info os.FileInfo) bool {
+	return !r.legacy && r.Size == info.Size() && r.ModTime == info.ModTime().UnixNano() && r.Inode == inode(info)
+}
+
+// loadRecord reads the record for a file, returning nil if it has never passed a check
+func (c *Checkrr) loadRecord(path string) (*FileRecord, error) {
+	var record *FileRecord
+	err := c.DB.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte("Checkrr")).Get([]byte(path))
+		if v == nil {
+			return nil
+		}
+		record = &FileRecord{}
+		if json.Unmarshal(v, record) != nil && len(v) == imohash.Size {
+			// a raw hash from before records existed, it is rewritten next time the file matches
+			record = &FileRecord{Hash: hex.EncodeToString(v), legacy: true}
+		}
+		return nil
+	})
+	return record, err
+}
+
+// storeRecord saves the current state of a file that passed its checks, including a full hash if fullhash is on
+func (c *Checkrr) storeRecord(ctx context.Context, path string, sum [imohash.Size]byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	record := &FileRecord{
+		Size:        info.Size(),
+		ModTime:     info.ModTime().UnixNano(),
+		Inode:       inode(info),
+		Hash:        hex.EncodeToString(sum[:]),
+		LastChecked: time.Now().UTC().Unix(),
+		Profile:     c.profileFor(path),
+	}
+	// a file that just went through a full decode doesn't need the deep scan for a while
+	if slices.Contains(strings.Split(record.Profile, ","), "ffmpeg-full") {
+		record.DeepChecked = record.LastChecked
+	}
+	if c.hashAlgo != "" {
+		record.FullHash, err = fullHash(ctx, c.hashAlgo, path)
+		if err != nil {
+			return err
+		}
+		record.HashAlgo = c.hashAlgo
+		record.Verified = record.LastChecked
+	}
+	return c.putRecord(path, record)
+}
+
+func (c *Checkrr) putRecord(path string, record *FileRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return c.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("Checkrr")).Put([]byte(path), data)
+	})
+}
+
+// moveRecord moves the record of a file that checkrr renamed to its new path
+func (c *Checkrr) moveRecord(oldPath string, newPath string) error {
+	return c.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("Checkrr"))
+		v := b.Get([]byte(oldPath))
+		if v == nil {
+			return nil
+		}
+		if err := b.Put([]byte(newPath), slices.Clone(v)); err != nil {
+			return err
+		}
+		return b.Delete([]byte(oldPath))
+	})
+}
+
+// profileFor names the check stages a file goes through, so records show what a file was checked with
+func (c *Checkrr) profileFor(path string) string {
+	var names []string
+	for _, checker := range c.checkersFor(path) {
+		names = append(names, checker.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+// missedStages reports whether the checks for a file now include a stage it wasn't checked with when its record was
+// stored, in which case the record can't vouch for it. When the deep scan is on and only decode stages were missed,
+// the file is left to the deep scan, which decodes files that never had one first and keeps to its budget.
+func (c *Checkrr) missedStages(path string, record *FileRecord) bool {
+	checked := strings.Split(record.Profile, ",")
+	deepScan := c.config.Bool("deepscan.enabled")
+	for _, checker := range c.checkersFor(path) {
+		name := checker.Name()
+		if slices.Contains(checked, name) {
+			continue
+		}
+		if deepScan && (name == "ffmpeg-quick" || name == "ffmpeg-full") {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+func (c *Checkrr) logRecordError(path string, err error) {
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "DBFailure",
+		TemplateData: map[string]interface{}{
+			"Error": err.Error(),
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Path": path, "DB Update": "Failure"}).Warn(message)
+}
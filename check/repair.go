@@ -0,0 +1,100 @@
+package check
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+)
+
+// repairableChecks are the stages whose failures can come from the container rather than the streams, which a
+// remux can fix. Codec, language and checksum failures can't be repaired this way.
+var repairableChecks = []string{"ffprobe", "ffmpeg-quick", "ffmpeg-full", "deepscan"}
+
+// repairFile tries to fix a failed file with a lossless remux. The remuxed copy has to pass the repairable stages
+// among stages before it replaces the original, the caller runs the rest against the replaced file. It reports
+// whether the file was repaired.
+func (c *Checkrr) repairFile(file *FileContext, verdict Verdict, stages []Checker) bool {
+	if !file.Profile.config.Bool("repair") || c.dryRun || !slices.Contains(repairableChecks, verdict.Check) {
+		return false
+	}
+	path := file.Path
+
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckRepairing",
+		TemplateData: map[string]interface{}{
+			"Path": path,
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Repair": true}).Info(message)
+
+	// the copy sits next to the original, hidden and keeping the extension so ffmpeg picks the same container, so
+	// swapping it in is a single rename
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".checkrr-repair"+filepath.Ext(path))
+	defer os.Remove(tmp)
+
+	c.ffmpegSlots <- struct{}{}
+	out, err := runFFmpeg(file.Ctx, []string{"-v", "error", "-y", "-i", path, "-map", "0", "-c", "copy", "-ignore_unknown", tmp})
+	<-c.ffmpegSlots
+	if err != nil {
+		c.logRepairFailed(path, firstLine(out+" "+err.Error()))
+		return false
+	}
+
+	// only the stages that judge the container run on the copy, the others could rename, strip or record it
+	repaired := &FileContext{Ctx: file.Ctx, Path: tmp, Root: file.Root, Type: file.Type, Header: file.Header, Profile: file.Profile, Verifying: true}
+	for _, checker := range stages {
+		if !repairable(checker) {
+			continue
+		}
+		result := checker.Check(repaired)
+		if file.Ctx.Err() != nil {
+			return false
+		}
+		if result.Result != Pass {
+			c.logRepairFailed(path, result.Reason)
+			return false
+		}
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		_ = os.Chmod(tmp, info.Mode())
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		c.logRepairFailed(path, err.Error())
+		return false
+	}
+	file.Probe = repaired.Probe
+	if file.Probe != nil && file.Probe.Format != nil {
+		file.Probe.Format.Filename = path
+	}
+
+	message = c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckRepaired",
+		TemplateData: map[string]interface{}{
+			"Path": path,
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Repair": true}).Info(message)
+	c.recordBadFile(path, "repaired", verdict)
+	return true
+}
+
+// repairable reports whether a stage judges the things a remux can fix
+func repairable(checker Checker) bool {
+	return slices.Contains(repairableChecks, checker.Name())
+}
+
+func (c *Checkrr) logRepairFailed(path string, reason string) {
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckRepairFailed",
+		TemplateData: map[string]interface{}{
+			"Path":   path,
+			"Reason": reason,
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Repair": false}).Warn(message)
+}
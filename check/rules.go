@@ -0,0 +1,385 @@
+package check
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/koanf/v2"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/vansante/go-ffprobe.v2"
+)
+
+func init() {
+	RegisterChecker("rules", func(c *Checkrr) Checker { return &rulesChecker{c: c} })
+}
+
+// Rule is a test against the ffprobe output. Every condition in Match has to hold for the rule to match. With
+// Stream set the conditions are tested against each stream of that type (or every stream for "any"), otherwise
+// against the file as a whole.
+type Rule struct {
+	Name   string
+	Reason string
+	// Action is one of flag, reacquire, quarantine or strip
+	Action string
+	// Paths limits the rule to files matching these patterns, they work like ignorepaths entries
+	Paths  []string
+	Stream string
+	Match  map[string]string
+	paths  []pathPattern
+}
+
+// rulesChecker runs the rules list of the file's checkpath against the probed file. It needs the ffprobe stage to
+// run before it.
+type rulesChecker struct {
+	c *Checkrr
+}
+
+func (c *Checkrr) loadRules(config *koanf.Koanf) []Rule {
+	var rules []Rule
+	for i, conf := range config.Slices("rules") {
+		rule := Rule{
+			Name:   conf.String("name"),
+			Reason: conf.String("reason"),
+			Action: conf.String("action"),
+			Paths:  conf.Strings("paths"),
+			Stream: conf.String("stream"),
+			Match:  map[string]string{},
+		}
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if rule.Reason == "" {
+			rule.Reason = rule.Name
+		}
+		// a rule only does something destructive when it asks to
+		if rule.Action == "" {
+			rule.Action = "flag"
+		}
+		// match keys like tag.title or count.audio come back flattened
+		for key, value := range conf.Cut("match").All() {
+			rule.Match[strings.ToLower(key)] = fmt.Sprint(value)
+		}
+		// a rule without conditions matches everything, an empty or mis-indented match block must not act on the
+		// whole library
+		if err := rule.validate(); err != "" {
+			message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "CheckRuleInvalid",
+				TemplateData: map[string]interface{}{
+					"Name":  rule.Name,
+					"Error": err,
+				},
+			})
+			c.Logger.WithFields(log.Fields{"startup": true}).Error(message)
+			continue
+		}
+		if rule.Action == "strip" && rule.Stream != "audio" && rule.Stream != "subtitle" {
+			message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "CheckRuleBadStrip",
+				TemplateData: map[string]interface{}{
+					"Name": rule.Name,
+				},
+			})
+			c.Logger.WithFields(log.Fields{"startup": true}).Warn(message)
+			rule.Action = "flag"
+		}
+		if rule.Action == "quarantine" && config.String("quarantinepath") == "" {
+			message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "CheckRuleQuarantineNoPath",
+				TemplateData: map[string]interface{}{
+					"Name": rule.Name,
+				},
+			})
+			c.Logger.WithFields(log.Fields{"startup": true}).Warn(message)
+			rule.Action = "flag"
+		}
+		rule.paths = c.compilePatterns(rule.Paths)
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// validate returns what is wrong with a rule, or an empty string if it can be used
+func (r Rule) validate() string {
+	switch r.Action {
+	case "flag", "reacquire", "quarantine", "strip":
+	default:
+		return fmt.Sprintf("unknown action %q", r.Action)
+	}
+	switch r.Stream {
+	case "", "any", "video", "audio", "subtitle":
+	default:
+		return fmt.Sprintf("unknown stream type %q", r.Stream)
+	}
+	if len(r.Match) == 0 {
+		return "match has no conditions"
+	}
+	for field := range r.Match {
+		if !validField(field, r.Stream != "") {
+			return fmt.Sprintf("unknown match field %q", field)
+		}
+	}
+	return ""
+}
+
+// validField reports whether a match field is one streamField or formatField can look up. Stream fields only work
+// in rules that test streams.
+func validField(field string, stream bool) bool {
+	switch field {
+	case "format", "duration", "bitrate", "size":
+		return true
+	case "index", "type", "codec", "codec_long", "profile", "pix_fmt", "width", "height", "channels",
+		"channel_layout", "sample_rate", "color_transfer", "hdr", "language":
+		return stream
+	}
+	return (strings.HasPrefix(field, "tag.") && field != "tag.") ||
+		(strings.HasPrefix(field, "count.") && field != "count.")
+}
+
+func (r *rulesChecker) Name() string {
+	return "rules"
+}
+
+func (r *rulesChecker) Check(file *FileContext) Verdict {
+	c := r.c
+	data := file.Probe
+	if data == nil {
+		return Verdict{Result: Pass}
+	}
+
+	var strip []int
+	var stripReason string
+	for _, rule := range file.Profile.rules {
+		if !rule.appliesTo(file.Root, file.Path) {
+			continue
+		}
+		matched, streams := rule.evaluate(data)
+		if !matched {
+			continue
+		}
+
+		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "CheckRuleMatched",
+			TemplateData: map[string]interface{}{
+				"Name": rule.Name,
+				"Path": file.Path,
+			},
+		})
+		c.Logger.WithFields(log.Fields{"Rule": rule.Name, "Action": rule.Action}).Info(message)
+
+		details := map[string]interface{}{"rule": rule.Name}
+		if len(streams) > 0 {
+			details["streams"] = streams
+		}
+		switch rule.Action {
+		case "flag":
+			c.recordBadFile(file.Path, "flagged", Verdict{Result: Fail, Check: "rules", Reason: rule.Reason, Details: details})
+		case "strip":
+			strip = append(strip, streams...)
+			stripReason = rule.Reason
+		default:
+			return Verdict{Result: Fail, Reason: rule.Reason, Details: details, Action: rule.Action}
+		}
+	}
+
+	if len(strip) > 0 {
+		sort.Ints(strip)
+		return c.stripStreams(file, compactInts(strip), stripReason)
+	}
+	return Verdict{Result: Pass}
+}
+
+// appliesTo reports whether the rule covers a file under root, rules without paths cover everything
+func (r Rule) appliesTo(root string, file string) bool {
+	if len(r.Paths) == 0 {
+		return true
+	}
+	if matchPatterns(r.paths, root, file) {
+		return true
+	}
+	// unlike ignorepaths, an absolute path can name the checkpath itself or a folder above it
+	var absolute []pathPattern
+	for _, p := range r.paths {
+		if p.absolute {
+			absolute = append(absolute, p)
+		}
+	}
+	return root != "" && matchPatterns(absolute, "", root)
+}
+
+// evaluate tests the rule against the probe data, returning the matching stream indexes for stream rules
+func (r Rule) evaluate(data *ffprobe.ProbeData) (bool, []int) {
+	if r.Stream == "" {
+		return r.matches(func(field string) (string, bool) { return formatField(data, field) }), nil
+	}
+
+	var streams []int
+	for _, stream := range data.Streams {
+		if r.Stream != "any" && stream.CodecType != r.Stream {
+			continue
+		}
+		lookup := func(field string) (string, bool) {
+			if value, ok := streamField(stream, field); ok {
+				return value, true
+			}
+			return formatField(data, field)
+		}
+		if r.matches(lookup) {
+			streams = append(streams, stream.Index)
+		}
+	}
+	return len(streams) > 0, streams
+}
+
+func (r Rule) matches(lookup func(field string) (string, bool)) bool {
+	for field, want := range r.Match {
+		value, ok := lookup(field)
+		if !matchValue(value, ok, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchValue compares a field against a condition. Conditions starting with >, >=, <, <=, = or != compare numbers,
+// anything else is a case insensitive glob like "*commentary*". A leading ! negates a glob.
+func matchValue(value string, found bool, want string) bool {
+	want = strings.TrimSpace(want)
+	for _, op := range []string{">=", "<=", "!=", ">", "<", "="} {
+		if !strings.HasPrefix(want, op) {
+			continue
+		}
+		target, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimPrefix(want, op)), 64)
+		if err != nil {
+			break
+		}
+		have, err := strconv.ParseFloat(value, 64)
+		if !found || err != nil {
+			return false
+		}
+		switch op {
+		case ">=":
+			return have >= target
+		case "<=":
+			return have <= target
+		case "!=":
+			return have != target
+		case ">":
+			return have > target
+		case "<":
+			return have < target
+		default:
+			return have == target
+		}
+	}
+
+	negate := strings.HasPrefix(want, "!")
+	want = strings.TrimPrefix(want, "!")
+	matched, err := path.Match(strings.ToLower(want), strings.ToLower(value))
+	matched = found && err == nil && matched
+	return matched != negate
+}
+
+func streamField(stream *ffprobe.Stream, field string) (string, bool) {
+	switch field {
+	case "index":
+		return strconv.Itoa(stream.Index), true
+	case "type":
+		return stream.CodecType, true
+	case "codec":
+		return stream.CodecName, true
+	case "codec_long":
+		return stream.CodecLongName, true
+	case "profile":
+		return stream.Profile, true
+	case "pix_fmt":
+		return stream.PixFmt, true
+	case "width":
+		return strconv.Itoa(stream.Width), true
+	case "height":
+		return strconv.Itoa(stream.Height), true
+	case "channels":
+		return strconv.Itoa(stream.Channels), true
+	case "channel_layout":
+		return stream.ChannelLayout, true
+	case "sample_rate":
+		return stream.SampleRate, true
+	case "bitrate":
+		return stream.BitRate, stream.BitRate != ""
+	case "color_transfer":
+		return stream.ColorTransfer, true
+	case "hdr":
+		return hdrType(stream), true
+	case "language":
+		return streamTag(stream.TagList, "language")
+	}
+	if strings.HasPrefix(field, "tag.") {
+		return streamTag(stream.TagList, strings.TrimPrefix(field, "tag."))
+	}
+	return "", false
+}
+
+func formatField(data *ffprobe.ProbeData, field string) (string, bool) {
+	switch field {
+	case "format":
+		return data.Format.FormatName, true
+	case "duration":
+		return strconv.FormatFloat(data.Format.DurationSeconds, 'f', -1, 64), true
+	case "bitrate":
+		return data.Format.BitRate, data.Format.BitRate != ""
+	case "size":
+		return data.Format.Size, true
+	}
+	if strings.HasPrefix(field, "count.") {
+		kind := strings.TrimPrefix(field, "count.")
+		count := 0
+		for _, stream := range data.Streams {
+			if stream.CodecType == kind {
+				count++
+			}
+		}
+		return strconv.Itoa(count), true
+	}
+	if strings.HasPrefix(field, "tag.") {
+		return streamTag(data.Format.TagList, strings.TrimPrefix(field, "tag."))
+	}
+	return "", false
+}
+
+// streamTag looks a tag up ignoring case, containers don't agree on LANGUAGE vs language
+func streamTag(tags ffprobe.Tags, name string) (string, bool) {
+	for key := range tags {
+		if strings.EqualFold(key, name) {
+			value, err := tags.GetString(key)
+			return value, err == nil
+		}
+	}
+	return "", false
+}
+
+// hdrType names the HDR format of a video stream: dolbyvision, hdr10, hlg or sdr
+func hdrType(stream *ffprobe.Stream) string {
+	if _, err := stream.SideDataList.FindSideData("DOVI configuration record"); err == nil {
+		return "dolbyvision"
+	}
+	switch stream.ColorTransfer {
+	case "smpte2084":
+		return "hdr10"
+	case "arib-std-b67":
+		return "hlg"
+	}
+	return "sdr"
+}
+
+func compactInts(sorted []int) []int {
+	var out []int
+	for i, v := range sorted {
+		if i == 0 || v != sorted[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
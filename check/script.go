@@ -0,0 +1,171 @@
+package check
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+)
+
+// scriptChecker runs a user supplied command against each file. The file path and detected type are passed as the
+// last two arguments and as CHECKRR_PATH and CHECKRR_TYPE. A zero exit code passes the file, anything else fails it.
+// The command can print a JSON object like {"pass": false, "reason": "...", "details": {...}} to stdout to give a
+// reason, which also overrides the exit code.
+type scriptChecker struct {
+	c       *Checkrr
+	name    string
+	command string
+	args    []string
+	timeout time.Duration
+}
+
+type scriptOutput struct {
+	Pass    *bool                  `json:"pass"`
+	Reason  string                 `json:"reason"`
+	Details map[string]interface{} `json:"details"`
+}
+
+// registerScripts makes every entry under scripts available as a check stage of this Checkrr and returns their
+// names. Scripts can't take the name of a built in stage or of another script.
+func (c *Checkrr) registerScripts() []string {
+	var names []string
+	c.scripts = map[string]CheckerFactory{}
+	for _, conf := range c.config.Slices("scripts") {
+		script := scriptChecker{
+			name:    conf.String("name"),
+			command: conf.String("command"),
+			args:    conf.Strings("args"),
+			timeout: conf.Duration("timeout"),
+		}
+		if script.name == "" || script.command == "" {
+			message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "CheckScriptMissingArgs",
+			})
+			c.Logger.WithFields(log.Fields{"startup": true}).Warn(message)
+			continue
+		}
+		checkerFactoriesLock.Lock()
+		_, builtin := checkerFactories[script.name]
+		checkerFactoriesLock.Unlock()
+		if _, taken := c.scripts[script.name]; builtin || taken {
+			message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "CheckScriptNameTaken",
+				TemplateData: map[string]interface{}{
+					"Name": script.name,
+				},
+			})
+			c.Logger.WithFields(log.Fields{"startup": true}).Warn(message)
+			continue
+		}
+		c.scripts[script.name] = func(c *Checkrr) Checker {
+			s := script
+			s.c = c
+			return &s
+		}
+		names = append(names, script.name)
+	}
+	return names
+}
+
+func (s *scriptChecker) Name() string {
+	return s.name
+}
+
+func (s *scriptChecker) Check(file *FileContext) Verdict {
+	c := s.c
+
+	ctx := file.Ctx
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	args := append(append([]string{}, s.args...), file.Path, file.Type)
+	cmd := exec.CommandContext(ctx, s.command, args...)
+	cmd.Env = append(os.Environ(), "CHECKRR_PATH="+file.Path, "CHECKRR_TYPE="+file.Type, "CHECKRR_ROOT="+file.Root)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	c.Logger.WithFields(log.Fields{"Script": s.name}).Debugf("Running %s %v", s.command, args)
+	err := cmd.Run()
+	if file.Ctx.Err() != nil {
+		return Verdict{Result: Inconclusive}
+	}
+
+	var exitErr *exec.ExitError
+	exited := errors.As(err, &exitErr)
+	if ctx.Err() != nil || (err != nil && !exited) {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "CheckScriptError",
+			TemplateData: map[string]interface{}{
+				"Name":  s.name,
+				"Path":  file.Path,
+				"Error": err.Error(),
+			},
+		})
+		c.Logger.WithFields(log.Fields{"Script": s.name}).Error(message)
+		// we couldn't run the script, so we don't know anything about the file
+		return Verdict{Result: Inconclusive}
+	}
+
+	pass := err == nil
+	reason := ""
+	details := map[string]interface{}{}
+	if exitErr != nil {
+		details["exitCode"] = exitErr.ExitCode()
+	}
+
+	out := scriptOutput{}
+	if json.Unmarshal(bytes.TrimSpace(stdout.Bytes()), &out) == nil {
+		if out.Pass != nil {
+			pass = *out.Pass
+		}
+		reason = out.Reason
+		for k, v := range out.Details {
+			details[k] = v
+		}
+	}
+
+	if pass {
+		c.Logger.WithFields(log.Fields{"Script": s.name, "Pass": true}).Debugf("\"%s\"", file.Path)
+		return Verdict{Result: Pass}
+	}
+
+	if reason == "" {
+		reason = firstLine(stdout.String())
+	}
+	if reason == "" {
+		reason = firstLine(stderr.String())
+	}
+	if reason == "" {
+		reason = fmt.Sprintf("%s failed", s.name)
+	}
+
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckScriptFailed",
+		TemplateData: map[string]interface{}{
+			"Name":   s.name,
+			"Path":   file.Path,
+			"Reason": reason,
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Script": s.name, "Pass": false}).Info(message)
+	return Verdict{Result: Fail, Reason: reason, Details: details}
+}
+
+func firstLine(s string) string {
+	return strings.TrimSpace(strings.SplitN(strings.TrimSpace(s), "\n", 2)[0])
+}
@@ -0,0 +1,283 @@
+package check
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	RegisterChecker("checksums", func(c *Checkrr) Checker { return &checksumChecker{c: c} })
+}
+
+// checksumChecker verifies files against .sfv, .md5, .sha1 and .par2 files in the same directory that list them.
+// Files that no sidecar mentions pass.
+type checksumChecker struct {
+	c *Checkrr
+}
+
+// sidecarSum is a checksum for the file being checked, found in a sidecar
+type sidecarSum struct {
+	sidecar   string
+	algorithm string
+	expected  string
+}
+
+func (s *checksumChecker) Name() string {
+	return "checksums"
+}
+
+func (s *checksumChecker) Check(file *FileContext) Verdict {
+	c := s.c
+	sums := findSidecarSums(file.Path)
+	if len(sums) == 0 {
+		return Verdict{Result: Pass}
+	}
+
+	mismatch, actual, err := verifySidecarSums(file.Ctx, file.Path, sums)
+	if err != nil {
+		if file.Ctx.Err() == nil {
+			message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "CheckErrorReading",
+				TemplateData: map[string]interface{}{
+					"Path":  file.Path,
+					"Error": err.Error(),
+				},
+			})
+			c.Logger.WithFields(log.Fields{"Checksums": "failed"}).Warn(message)
+		}
+		return Verdict{Result: Inconclusive}
+	}
+	if mismatch == nil {
+		c.Logger.WithFields(log.Fields{"Checksums": true}).Debugf("\"%s\"", file.Path)
+		return Verdict{Result: Pass}
+	}
+
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckChecksumMismatch",
+		TemplateData: map[string]interface{}{
+			"Path":    file.Path,
+			"Sidecar": filepath.Base(mismatch.sidecar),
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Checksums": false, "Algorithm": mismatch.algorithm}).Info(message)
+
+	// a repair rewrites the file in place, which a dry run must never do
+	if mismatch.algorithm == "par2" && file.Profile.config.Bool("par2repair") && !c.dryRun && c.repairPar2(file, mismatch.sidecar) {
+		return Verdict{Result: Pass}
+	}
+
+	return Verdict{Result: Fail, Reason: "checksum mismatch", Details: map[string]interface{}{
+		"sidecar":   mismatch.sidecar,
+		"algorithm": mismatch.algorithm,
+		"expected":  mismatch.expected,
+		"actual":    actual,
+	}}
+}
+
+// repairPar2 asks par2 to rebuild a damaged file from its recovery set and reports whether it now verifies
+func (c *Checkrr) repairPar2(file *FileContext, par2 string) bool {
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckPar2Repairing",
+		TemplateData: map[string]interface{}{
+			"Path": file.Path,
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Par2": "repair"}).Info(message)
+
+	cmd := exec.CommandContext(file.Ctx, "par2", "repair", "-q", par2)
+	cmd.Dir = filepath.Dir(par2)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		c.Logger.WithFields(log.Fields{"Par2": "repair"}).Warn(firstLine(string(out)), " ", err)
+		return false
+	}
+	// par2 keeps the damaged copy as <name>.1, which would only get flagged on the next run
+	_ = os.Remove(file.Path + ".1")
+
+	mismatch, _, err := verifySidecarSums(file.Ctx, file.Path, findSidecarSums(file.Path))
+	if err != nil || mismatch != nil {
+		return false
+	}
+	message = c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckPar2Repaired",
+		TemplateData: map[string]interface{}{
+			"Path": file.Path,
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Par2": "repaired"}).Info(message)
+	return true
+}
+
+// verifySidecarSums reads the file once and returns the first checksum that doesn't match, along with the actual
+// value it had
+func verifySidecarSums(ctx context.Context, path string, sums []sidecarSum) (*sidecarSum, string, error) {
+	hashers := map[string]hash.Hash{}
+	var writers []io.Writer
+	for _, sum := range sums {
+		if _, ok := hashers[sum.algorithm]; ok {
+			continue
+		}
+		var h hash.Hash
+		switch sum.algorithm {
+		case "crc32":
+			h = crc32.NewIEEE()
+		case "md5", "par2":
+			h = md5.New()
+		case "sha1":
+			h = sha1.New()
+		}
+		hashers[sum.algorithm] = h
+		writers = append(writers, h)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	_, err = io.Copy(io.MultiWriter(writers...), ctxReader{ctx: ctx, r: f})
+	if err != nil {
+		return nil, "", err
+	}
+
+	for i, sum := range sums {
+		actual := hex.EncodeToString(hashers[sum.algorithm].Sum(nil))
+		if !strings.EqualFold(actual, sum.expected) {
+			return &sums[i], actual, nil
+		}
+	}
+	return nil, "", nil
+}
+
+// findSidecarSums collects every checksum for path from the sidecars next to it
+func findSidecarSums(path string) []sidecarSum {
+	dir := filepath.Dir(path)
+	name := filepath.Base(path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var sums []sidecarSum
+	var par2s []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		sidecar := filepath.Join(dir, entry.Name())
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".sfv":
+			sums = append(sums, lineSums(sidecar, name, "crc32")...)
+		case ".md5":
+			sums = append(sums, lineSums(sidecar, name, "md5")...)
+		case ".sha1":
+			sums = append(sums, lineSums(sidecar, name, "sha1")...)
+		case ".par2":
+			par2s = append(par2s, sidecar)
+		}
+	}
+
+	// the index file without .volXX+YY has the same file descriptions and is much smaller than the recovery volumes
+	sort.SliceStable(par2s, func(i, j int) bool {
+		return !strings.Contains(strings.ToLower(par2s[i]), ".vol") && strings.Contains(strings.ToLower(par2s[j]), ".vol")
+	})
+	for _, par2 := range par2s {
+		if sum, ok := par2Sum(par2, name); ok {
+			sums = append(sums, sum)
+			break
+		}
+	}
+	return sums
+}
+
+// lineSums reads a checksum list. SFV lines are "name CRC", md5sum and sha1sum lines are "hash  name" or "hash *name".
+// A <file>.md5 holding just the hash is accepted too.
+func lineSums(sidecar string, name string, algorithm string) []sidecarSum {
+	f, err := os.Open(sidecar)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var sums []sidecarSum
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var sum, file string
+		if algorithm == "crc32" {
+			i := strings.LastIndexAny(line, " \t")
+			if i < 0 {
+				continue
+			}
+			file, sum = strings.TrimSpace(line[:i]), line[i+1:]
+		} else {
+			fields := strings.SplitN(line, " ", 2)
+			sum = fields[0]
+			if len(fields) == 2 {
+				file = strings.TrimLeft(fields[1], " *")
+			} else if strings.EqualFold(filepath.Base(sidecar), name+filepath.Ext(sidecar)) {
+				file = name
+			}
+		}
+		if strings.EqualFold(filepath.Base(filepath.FromSlash(strings.ReplaceAll(file, `\`, "/"))), name) {
+			sums = append(sums, sidecarSum{sidecar: sidecar, algorithm: algorithm, expected: sum})
+		}
+	}
+	return sums
+}
+
+var par2Magic = []byte("PAR2\x00PKT")
+var par2FileDesc = []byte("PAR 2.0\x00FileDesc")
+
+// par2Sum finds the file description packet for name in a par2 file, which holds the MD5 of the whole file
+func par2Sum(par2 string, name string) (sidecarSum, bool) {
+	f, err := os.Open(par2)
+	if err != nil {
+		return sidecarSum{}, false
+	}
+	defer f.Close()
+
+	// packet header: magic, length, packet md5, recovery set id, type
+	header := make([]byte, 64)
+	for {
+		if _, err := io.ReadFull(f, header); err != nil || !bytes.Equal(header[:8], par2Magic) {
+			return sidecarSum{}, false
+		}
+		length := binary.LittleEndian.Uint64(header[8:16])
+		if length < 64 || length > 1<<24 {
+			return sidecarSum{}, false
+		}
+		body := make([]byte, length-64)
+		if _, err := io.ReadFull(f, body); err != nil {
+			return sidecarSum{}, false
+		}
+		// file description body: file id, full md5, 16k md5, length, name
+		if !bytes.Equal(header[48:64], par2FileDesc) || len(body) < 56 {
+			continue
+		}
+		file := string(bytes.TrimRight(body[56:], "\x00"))
+		if file == name {
+			return sidecarSum{sidecar: par2, algorithm: "par2", expected: fmt.Sprintf("%x", body[16:32])}, true
+		}
+	}
+}
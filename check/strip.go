@@ -0,0 +1,110 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/vansante/go-ffprobe.v2"
+)
+
+// stripStreams remuxes a file without the given streams, for removeaudio and removelang rules set to strip. It only
+// does so if an audio stream is left afterwards, and the result has to probe cleanly before it replaces the
+// original. Otherwise the file fails with reason like it would without the strip action.
+func (c *Checkrr) stripStreams(file *FileContext, strip []int, reason string) Verdict {
+	path := file.Path
+	fail := Verdict{Result: Fail, Reason: reason, Details: map[string]interface{}{"streams": strip, "action": "strip"}}
+
+	audio := 0
+	for _, stream := range file.Probe.Streams {
+		if stream.CodecType == "audio" && !slices.Contains(strip, stream.Index) {
+			audio++
+		}
+	}
+	if audio == 0 {
+		return fail
+	}
+	if c.dryRun {
+		c.recordBadFile(path, "stripped", fail)
+		return Verdict{Result: Pass}
+	}
+
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".checkrr-strip"+filepath.Ext(path))
+	defer os.Remove(tmp)
+
+	args := []string{"-v", "error", "-y", "-i", path, "-map", "0"}
+	for _, index := range strip {
+		args = append(args, "-map", fmt.Sprintf("-0:%d", index))
+	}
+	args = append(args, "-c", "copy", "-ignore_unknown", tmp)
+
+	c.ffmpegSlots <- struct{}{}
+	out, err := runFFmpeg(file.Ctx, args)
+	<-c.ffmpegSlots
+	if err != nil {
+		c.logStripFailed(path, firstLine(out+" "+err.Error()))
+		return fail
+	}
+
+	// make sure we got what we asked for before throwing the original away
+	c.probeSlots <- struct{}{}
+	probeCtx, probeCancel := context.WithTimeout(file.Ctx, 30*time.Second)
+	data, err := ffprobe.ProbeURL(probeCtx, tmp)
+	probeCancel()
+	<-c.probeSlots
+	if err != nil {
+		c.logStripFailed(path, err.Error())
+		return fail
+	}
+	if len(data.Streams) != len(file.Probe.Streams)-len(strip) || data.FirstAudioStream() == nil {
+		c.logStripFailed(path, "unexpected streams after remux")
+		return fail
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		_ = os.Chmod(tmp, info.Mode())
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		c.logStripFailed(path, err.Error())
+		return fail
+	}
+	subtitles := false
+	for _, stream := range file.Probe.Streams {
+		if stream.CodecType == "subtitle" && slices.Contains(strip, stream.Index) {
+			subtitles = true
+		}
+	}
+	data.Format.Filename = path
+	file.Probe = data
+
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckStripped",
+		TemplateData: map[string]interface{}{
+			"Path":    path,
+			"Streams": strip,
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Strip": true}).Info(message)
+	c.recordBadFile(path, "stripped", fail)
+	if subtitles {
+		c.searchSubtitles(file)
+	}
+	return Verdict{Result: Pass}
+}
+
+func (c *Checkrr) logStripFailed(path string, reason string) {
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckStripFailed",
+		TemplateData: map[string]interface{}{
+			"Path":   path,
+			"Reason": reason,
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Strip": false}).Warn(message)
+}
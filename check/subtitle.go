@@ -0,0 +1,333 @@
+package check
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kalafut/imohash"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/text/encoding/unicode"
+	"gopkg.in/vansante/go-ffprobe.v2"
+)
+
+// subtitleExts are the subtitle formats checked when subtitles is on. Text formats are parsed, image formats are
+// probed with ffprobe.
+var subtitleExts = map[string]bool{".srt": true, ".vtt": true, ".ass": true, ".ssa": true, ".sup": true, ".idx": true, ".sub": true}
+
+// maxSubtitleSize is the biggest text subtitle that gets parsed, anything larger isn't a subtitle
+const maxSubtitleSize = 20 << 20
+
+var (
+	srtTiming = regexp.MustCompile(`^(\d{1,2}):(\d{2}):(\d{2})[,.](\d{1,3})\s*-->\s*(\d{1,2}):(\d{2}):(\d{2})[,.](\d{1,3})`)
+	vttTiming = regexp.MustCompile(`^(?:(\d+):)?(\d{2}):(\d{2})\.(\d{3})\s+-->\s+(?:(\d+):)?(\d{2}):(\d{2})\.(\d{3})`)
+	assTime   = regexp.MustCompile(`^\d+:\d{2}:\d{2}[.:]\d{2,3}$`)
+)
+
+// isSubtitle reports whether a file is one checkrr validates as a subtitle
+func (c *Checkrr) isSubtitle(path string) bool {
+	return subtitleExts[strings.ToLower(filepath.Ext(path))] && c.profileOf(path).config.Bool("subtitles")
+}
+
+// checkSubtitle validates a subtitle file. Files that pass get a record like any other file so they are skipped
+// until they change, bad ones are reported.
+func (c *Checkrr) checkSubtitle(ctx context.Context, path string) {
+	c.count(ctx, "NonVideo")
+	file := &FileContext{Ctx: ctx, Path: path, Root: c.rootFor(path), Type: "Subtitle", Profile: c.profileOf(path)}
+
+	var verdict Verdict
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".sup", ".idx", ".sub":
+		verdict = c.probeSubtitle(file)
+	default:
+		verdict = c.parseSubtitle(path)
+	}
+	if ctx.Err() != nil || verdict.Result == Inconclusive {
+		return
+	}
+	if verdict.Result == Fail {
+		verdict.Check = "subtitles"
+		c.badSubtitle(file, verdict)
+		return
+	}
+
+	c.Logger.WithFields(log.Fields{"Type": "Subtitle", "Subtitle": true}).Infof("\"%s\"", path)
+	sum, err := imohash.SumFile(path)
+	if err == nil {
+		err = c.storeRecord(ctx, path, sum)
+	}
+	if err != nil {
+		c.logRecordError(path, err)
+	}
+}
+
+// badSubtitle reports a subtitle that failed validation and hands it to Bazarr if one manages it. The video it
+// belongs to is fine, so it never goes through deleteFile.
+func (c *Checkrr) badSubtitle(file *FileContext, verdict Verdict) {
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckBadSubtitle",
+		TemplateData: map[string]interface{}{
+			"Path":   file.Path,
+			"Reason": verdict.Reason,
+		},
+	})
+	fields := log.Fields{"Type": "Subtitle", "Subtitle": false}
+	for k, v := range verdict.Details {
+		fields[k] = v
+	}
+	c.Logger.WithFields(fields).Warn(message)
+	if c.replaceSubtitle(file, verdict) {
+		return
+	}
+	c.recordBadFile(file.Path, "subtitle", verdict)
+}
+
+// probeSubtitle checks an image based subtitle with ffprobe, it has to open and hold a subtitle stream
+func (c *Checkrr) probeSubtitle(file *FileContext) Verdict {
+	if strings.EqualFold(filepath.Ext(file.Path), ".sub") {
+		// VobSub pairs are probed through the .idx, which reads the .sub next to it
+		idx := strings.TrimSuffix(file.Path, filepath.Ext(file.Path)) + ".idx"
+		if _, err := os.Stat(idx); err == nil {
+			return Verdict{Result: Pass}
+		}
+	}
+
+	c.probeSlots <- struct{}{}
+	probeCtx, probeCancel := context.WithTimeout(file.Ctx, 30*time.Second)
+	data, err := ffprobe.ProbeURL(probeCtx, file.Path)
+	probeCancel()
+	<-c.probeSlots
+	if file.Ctx.Err() != nil {
+		return Verdict{Result: Inconclusive}
+	}
+	if err != nil {
+		return Verdict{Result: Fail, Reason: "unreadable subtitle", Details: map[string]interface{}{"error": err.Error()}}
+	}
+	for _, stream := range data.Streams {
+		if stream.CodecType == "subtitle" {
+			return Verdict{Result: Pass}
+		}
+	}
+	return Verdict{Result: Fail, Reason: "no subtitle stream"}
+}
+
+// parseSubtitle checks a text subtitle for emptiness, encoding problems and structural errors
+func (c *Checkrr) parseSubtitle(path string) Verdict {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Verdict{Result: Inconclusive}
+	}
+	if info.Size() > maxSubtitleSize {
+		return Verdict{Result: Fail, Reason: "subtitle too large", Details: map[string]interface{}{"size": info.Size()}}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Verdict{Result: Inconclusive}
+	}
+
+	text, err := decodeSubtitle(data, c.profileOf(path).config.Bool("subtitleutf8"))
+	if err != nil {
+		return Verdict{Result: Fail, Reason: "bad encoding", Details: map[string]interface{}{"error": err.Error()}}
+	}
+	if strings.TrimSpace(text) == "" {
+		return Verdict{Result: Fail, Reason: "empty subtitle"}
+	}
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".vtt":
+		err = validateVTT(lines)
+	case ".ass", ".ssa":
+		err = validateASS(lines)
+	default:
+		err = validateSRT(lines)
+	}
+	if err != nil {
+		return Verdict{Result: Fail, Reason: "malformed subtitle", Details: map[string]interface{}{"error": err.Error()}}
+	}
+	return Verdict{Result: Pass}
+}
+
+// decodeSubtitle turns subtitle bytes into text. UTF-16 files need a byte order mark, everything else has to be
+// UTF-8, or any 8 bit encoding without control characters unless requireUTF8 is set.
+func decodeSubtitle(data []byte, requireUTF8 bool) (string, error) {
+	if bytes.HasPrefix(data, []byte{0xff, 0xfe}) || bytes.HasPrefix(data, []byte{0xfe, 0xff}) {
+		decoded, err := unicode.UTF16(unicode.BigEndian, unicode.UseBOM).NewDecoder().Bytes(data)
+		if err != nil {
+			return "", err
+		}
+		data = decoded
+	}
+	data = bytes.TrimPrefix(data, []byte{0xef, 0xbb, 0xbf})
+
+	if bytes.IndexByte(data, 0) >= 0 {
+		return "", fmt.Errorf("contains null bytes")
+	}
+	if utf8.Valid(data) {
+		return string(data), nil
+	}
+	if requireUTF8 {
+		return "", fmt.Errorf("not valid UTF-8")
+	}
+	for _, b := range data {
+		if b < 0x20 && b != '\n' && b != '\r' && b != '\t' {
+			return "", fmt.Errorf("contains control characters")
+		}
+	}
+	// a legacy code page, the letters don't matter for the structure
+	return strings.ToValidUTF8(string(data), "?"), nil
+}
+
+func validateSRT(lines []string) error {
+	cues := 0
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+		// a cue is an optional counter, a timing line and its text up to the next blank line
+		if !strings.Contains(line, "-->") && i+1 < len(lines) {
+			i++
+			line = strings.TrimSpace(lines[i])
+		}
+		m := srtTiming.FindStringSubmatch(line)
+		if m == nil {
+			return fmt.Errorf("line %d: expected a timing line, got %q", i+1, truncate(line, 40))
+		}
+		if err := checkTimes(m[1:5], m[5:9]); err != nil {
+			return fmt.Errorf("line %d: %w", i+1, err)
+		}
+		cues++
+		for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+			i++
+		}
+	}
+	if cues == 0 {
+		return fmt.Errorf("no cues")
+	}
+	return nil
+}
+
+func validateVTT(lines []string) error {
+	if !strings.HasPrefix(strings.TrimSpace(lines[0]), "WEBVTT") {
+		return fmt.Errorf("missing WEBVTT header")
+	}
+	cues := 0
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if !strings.Contains(line, "-->") {
+			continue
+		}
+		m := vttTiming.FindStringSubmatch(line)
+		if m == nil {
+			return fmt.Errorf("line %d: bad timing line %q", i+1, truncate(line, 40))
+		}
+		if err := checkTimes(m[1:5], m[5:9]); err != nil {
+			return fmt.Errorf("line %d: %w", i+1, err)
+		}
+		cues++
+	}
+	if cues == 0 {
+		return fmt.Errorf("no cues")
+	}
+	return nil
+}
+
+func validateASS(lines []string) error {
+	section := ""
+	scriptInfo := false
+	var format []string
+	dialogues := 0
+	for i, raw := range lines {
+		line := strings.TrimSpace(raw)
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(line)
+			if section == "[script info]" {
+				scriptInfo = true
+			}
+			continue
+		}
+		if section != "[events]" {
+			continue
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "format":
+			format = splitFields(value, -1)
+		case "dialogue":
+			if format == nil {
+				return fmt.Errorf("line %d: dialogue before the events format line", i+1)
+			}
+			// the text is the last field and can hold commas itself
+			fields := splitFields(value, len(format))
+			if len(fields) < len(format) {
+				return fmt.Errorf("line %d: dialogue has %d of %d fields", i+1, len(fields), len(format))
+			}
+			for j, name := range format {
+				if (strings.EqualFold(name, "start") || strings.EqualFold(name, "end")) && !assTime.MatchString(fields[j]) {
+					return fmt.Errorf("line %d: bad %s time %q", i+1, strings.ToLower(name), fields[j])
+				}
+			}
+			dialogues++
+		}
+	}
+	if !scriptInfo {
+		return fmt.Errorf("missing [Script Info] section")
+	}
+	if dialogues == 0 {
+		return fmt.Errorf("no dialogue lines")
+	}
+	return nil
+}
+
+// checkTimes makes sure a cue doesn't end before it starts, each side is hours, minutes, seconds and fraction. The
+// fraction is a decimal, so .5 is half a second however many digits the format uses.
+func checkTimes(start []string, end []string) error {
+	var times [2]time.Duration
+	for i, parts := range [][]string{start, end} {
+		var m, s int
+		fmt.Sscan(parts[1], &m)
+		fmt.Sscan(parts[2], &s)
+		if m > 59 || s > 59 {
+			return fmt.Errorf("time out of range")
+		}
+		hours := parts[0]
+		if hours == "" {
+			hours = "0"
+		}
+		d, err := time.ParseDuration(fmt.Sprintf("%sh%sm%s.%ss", hours, parts[1], parts[2], parts[3]))
+		if err != nil {
+			return fmt.Errorf("bad time: %w", err)
+		}
+		times[i] = d
+	}
+	if times[1] < times[0] {
+		return fmt.Errorf("cue ends before it starts")
+	}
+	return nil
+}
+
+func splitFields(value string, n int) []string {
+	fields := strings.SplitN(value, ",", n)
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	return fields
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,163 @@
+package check
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// SuspectFile is a file that failed once. It is only handed off as bad if the failure shows up again.
+type SuspectFile struct {
+	Reason    string `json:"reason"`
+	FirstSeen int64  `json:"firstSeen"`
+}
+
+// confirmSuspect records the first failure of a file and reports whether a repeat failure confirms it as bad
+func (c *Checkrr) confirmSuspect(path string, reason string) bool {
+	suspect := SuspectFile{}
+	found := false
+
+	err := c.DB.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte("Checkrr-suspect")).Get([]byte(path))
+		if v == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(v, &suspect)
+	})
+	if err != nil {
+		c.logSuspectDBError(err)
+		return false
+	}
+
+	if found {
+		due := time.Unix(suspect.FirstSeen, 0).Add(c.suspectDelay)
+		if time.Now().Before(due) {
+			return false
+		}
+		c.clearSuspect(path)
+		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "CheckSuspectConfirmed",
+			TemplateData: map[string]interface{}{
+				"Path": path,
+			},
+		})
+		c.Logger.WithFields(log.Fields{"Suspect": "confirmed"}).Warn(message)
+		return true
+	}
+
+	suspect = SuspectFile{Reason: reason, FirstSeen: time.Now().UTC().Unix()}
+	err = c.DB.Update(func(tx *bolt.Tx) error {
+		j, err := json.Marshal(suspect)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("Checkrr-suspect")).Put([]byte(path), j)
+	})
+	if err != nil {
+		c.logSuspectDBError(err)
+	}
+
+	c.suspectLock.Lock()
+	c.suspects = append(c.suspects, path)
+	c.suspectLock.Unlock()
+
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckSuspect",
+		TemplateData: map[string]interface{}{
+			"Path":   path,
+			"Reason": reason,
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Suspect": "recorded"}).Warn(message)
+	return false
+}
+
+// clearSuspect drops a file from the suspect list, typically because it passed a later check
+func (c *Checkrr) clearSuspect(path string) {
+	err := c.DB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("Checkrr-suspect"))
+		if b.Get([]byte(path)) == nil {
+			return nil
+		}
+		c.Logger.WithFields(log.Fields{"Suspect": "cleared"}).Debugf("\"%s\"", path)
+		return b.Delete([]byte(path))
+	})
+	if err != nil {
+		c.logSuspectDBError(err)
+	}
+}
+
+// recheckSuspects queues the files that became suspects during this run to be checked again once suspectdelay has
+// passed, without holding up the run. Without a delay, or if the timers are stopped first, they are left for the
+// next run.
+func (c *Checkrr) recheckSuspects() {
+	c.suspectLock.Lock()
+	defer c.suspectLock.Unlock()
+	suspects := c.suspects
+	c.suspects = nil
+	if c.suspectDelay <= 0 || c.ctx.Err() != nil {
+		return
+	}
+	for _, path := range suspects {
+		suspect := SuspectFile{}
+		err := c.DB.View(func(tx *bolt.Tx) error {
+			v := tx.Bucket([]byte("Checkrr-suspect")).Get([]byte(path))
+			if v == nil {
+				return nil
+			}
+			return json.Unmarshal(v, &suspect)
+		})
+		if err != nil {
+			c.logSuspectDBError(err)
+			continue
+		}
+		if suspect.FirstSeen == 0 {
+			continue
+		}
+
+		if c.suspectTimers == nil {
+			c.suspectTimers = map[string]*time.Timer{}
+		}
+		if timer, ok := c.suspectTimers[path]; ok {
+			timer.Stop()
+		}
+		c.suspectTimers[path] = time.AfterFunc(time.Until(time.Unix(suspect.FirstSeen, 0).Add(c.suspectDelay)), func() {
+			c.suspectLock.Lock()
+			delete(c.suspectTimers, path)
+			c.suspectLock.Unlock()
+
+			message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "CheckSuspectRecheck",
+				TemplateData: map[string]interface{}{
+					"Path": path,
+				},
+			})
+			c.Logger.WithFields(log.Fields{"Suspect": "recheck"}).Info(message)
+			c.Queue([]string{path})
+		})
+	}
+}
+
+// stopSuspectTimers cancels the pending suspect rechecks. The suspects stay recorded, so the next run rechecks them.
+func (c *Checkrr) stopSuspectTimers() {
+	c.suspectLock.Lock()
+	defer c.suspectLock.Unlock()
+	for path, timer := range c.suspectTimers {
+		timer.Stop()
+		delete(c.suspectTimers, path)
+	}
+}
+
+func (c *Checkrr) logSuspectDBError(err error) {
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "DBFailure",
+		TemplateData: map[string]interface{}{
+			"Error": err.Error(),
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Suspect": true, "DB Update": "Failure"}).Warn(message)
+}
@@ -0,0 +1,136 @@
+package check
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+)
+
+// Watch checks new and modified files under the checkpaths once they have stopped changing for watchsettle. It
+// blocks until stop is closed. Files that settle while a scheduled run is going are checked after it finishes.
+func (c *Checkrr) Watch(stop <-chan struct{}) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		c.logWatchError(err)
+		return
+	}
+	defer watcher.Close()
+
+	settle := c.config.Duration("watchsettle")
+	if settle <= 0 {
+		settle = time.Minute
+	}
+	tick := settle / 4
+	if tick < time.Second {
+		tick = time.Second
+	}
+
+	// path -> time of the last change we saw
+	pending := map[string]time.Time{}
+
+	for _, root := range c.checkpaths() {
+		c.watchTree(watcher, root, nil)
+	}
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckWatchStarted",
+		TemplateData: map[string]interface{}{
+			"Settle": settle.String(),
+		},
+	})
+	c.Logger.WithFields(log.Fields{"startup": true, "Watch": true}).Info(message)
+
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	// settled files go on the queue, so we keep draining events while they are checked
+	for {
+		select {
+		case <-stop:
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				delete(pending, event.Name)
+				continue
+			}
+			if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			info, err := os.Stat(event.Name)
+			if err != nil {
+				continue
+			}
+			if info.IsDir() {
+				// directories moved or created under a root need watching too, and anything already in them checking
+				c.watchTree(watcher, event.Name, pending)
+				continue
+			}
+			pending[event.Name] = time.Now()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			c.logWatchError(err)
+		case now := <-ticker.C:
+			var ready []string
+			for path, last := range pending {
+				// catch writes we didn't get an event for, like a copy over a network mount
+				if info, err := os.Stat(path); err != nil {
+					delete(pending, path)
+					continue
+				} else if info.ModTime().After(last) {
+					pending[path] = info.ModTime()
+					last = info.ModTime()
+				}
+				if now.Sub(last) >= settle {
+					ready = append(ready, path)
+				}
+			}
+			if len(ready) == 0 {
+				continue
+			}
+			c.Logger.WithFields(log.Fields{"Watch": true}).Debugf("%d settled files to check", len(ready))
+			for _, path := range ready {
+				delete(pending, path)
+			}
+			c.Queue(ready)
+		}
+	}
+}
+
+// watchTree adds a directory and everything under it to the watcher. If pending is set, files already in the tree
+// are queued for checking.
+func (c *Checkrr) watchTree(watcher *fsnotify.Watcher, root string, pending map[string]time.Time) {
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return watcher.Add(path)
+		}
+		if pending != nil {
+			pending[path] = time.Now()
+		}
+		return nil
+	})
+	if err != nil {
+		c.logWatchError(err)
+	}
+}
+
+func (c *Checkrr) logWatchError(err error) {
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckWatchError",
+		TemplateData: map[string]interface{}{
+			"Error": err.Error(),
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Watch": true}).Warn(message)
+}
@@ -0,0 +1,66 @@
+package check
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/aetaric/checkrr/connections"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	log "github.com/sirupsen/logrus"
+)
+
+// QueueImport maps files reported by an arr webhook back through that arr's mappings and queues them to be checked.
+// arr is the name of the entry under arr in the config. It returns the local paths that were queued.
+func (c *Checkrr) QueueImport(arr string, paths []string) ([]string, error) {
+	conf := c.FullConfig.Cut("arr").Cut(arr)
+	var local func(string) string
+	switch conf.String("service") {
+	case "sonarr":
+		sonarr := connections.Sonarr{Log: c.Logger, Localizer: c.Localizer}
+		sonarr.FromConfig(conf)
+		local = sonarr.LocalPath
+	case "radarr":
+		radarr := connections.Radarr{Log: c.Logger, Localizer: c.Localizer}
+		radarr.FromConfig(conf)
+		local = radarr.LocalPath
+	case "lidarr":
+		lidarr := connections.Lidarr{Log: c.Logger, Localizer: c.Localizer}
+		lidarr.FromConfig(conf)
+		local = lidarr.LocalPath
+	case "readarr":
+		readarr := connections.Readarr{Log: c.Logger, Localizer: c.Localizer}
+		readarr.FromConfig(conf)
+		local = readarr.LocalPath
+	default:
+		return nil, fmt.Errorf("no arr named %s is configured", arr)
+	}
+
+	var queued []string
+	for _, path := range paths {
+		path = local(path)
+		// only files under a checkpath are ever checked, anything else in a webhook is ignored
+		if !filepath.IsAbs(path) || c.rootFor(path) == "" {
+			message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "CheckImportOutside",
+				TemplateData: map[string]interface{}{
+					"Arr":  arr,
+					"Path": path,
+				},
+			})
+			c.Logger.WithFields(log.Fields{"Webhook": arr}).Warn(message)
+			continue
+		}
+		queued = append(queued, filepath.Clean(path))
+	}
+
+	message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "CheckImportQueued",
+		TemplateData: map[string]interface{}{
+			"Arr":   arr,
+			"Count": len(queued),
+		},
+	})
+	c.Logger.WithFields(log.Fields{"Webhook": arr}).Info(message)
+	c.Queue(queued)
+	return queued, nil
+}
@@ -0,0 +1,325 @@
+package connections
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aetaric/checkrr/logging"
+	"github.com/knadh/koanf/v2"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+)
+
+// Bazarr talks to the Bazarr API, there's no starr client for it. Series come from Sonarr and movies from Radarr,
+// so every subtitle Bazarr manages belongs to an episode or a movie.
+type Bazarr struct {
+	// Name is the key of this service under arr in the config
+	Name      string
+	client    *http.Client
+	url       string
+	Process   bool
+	ApiKey    string
+	Address   string
+	Port      int
+	BaseURL   string
+	SSL       bool
+	pathMaps  map[string]string
+	series    *pathCache[int64]
+	movies    *pathCache[int64]
+	Log       *logging.Log
+	Localizer *i18n.Localizer
+}
+
+// bazarrSubtitle is a subtitle Bazarr knows about, embedded ones have no path
+type bazarrSubtitle struct {
+	Code2  string `json:"code2"`
+	Path   string `json:"path"`
+	Forced bool   `json:"forced"`
+	HI     bool   `json:"hi"`
+}
+
+// bazarrMedia is an episode or movie as Bazarr lists it
+type bazarrMedia struct {
+	SeriesID  int64            `json:"sonarrSeriesId"`
+	EpisodeID int64            `json:"sonarrEpisodeId"`
+	RadarrID  int64            `json:"radarrId"`
+	Path      string           `json:"path"`
+	Subtitles []bazarrSubtitle `json:"subtitles"`
+}
+
+func (b *Bazarr) FromConfig(conf *koanf.Koanf) {
+	if conf != nil {
+		b.Address = conf.String("address")
+		b.Process = conf.Bool("process")
+		b.ApiKey = conf.String("apikey")
+		b.Port = conf.Int("port")
+		b.BaseURL = conf.String("baseurl")
+		b.pathMaps = conf.StringMap("mappings")
+		b.SSL = conf.Bool("ssl")
+		b.Log.Debugf("Bazarr Path Maps: %v", b.pathMaps)
+	} else {
+		b.Process = false
+	}
+}
+
+// MatchPath reports whether a file is under a series or movie folder Bazarr manages
+func (b *Bazarr) MatchPath(path string) bool {
+	_, _, ok := b.media(b.translatePath(path))
+	return ok
+}
+
+// RemoveFile has Bazarr delete a subtitle file it manages and download that language again. For a video file, or a
+// subtitle Bazarr doesn't know about, Bazarr rescans the series or movie and searches for whatever is missing.
+func (b *Bazarr) RemoveFile(path string) bool {
+	arrPath := b.translatePath(path)
+	kind, id, ok := b.media(arrPath)
+	if !ok {
+		return false
+	}
+	message := b.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "ArrDebugMatchedMedia",
+		TemplateData: map[string]interface{}{
+			"Type": kind,
+			"ID":   id,
+			"Path": path,
+		},
+	})
+	b.Log.Debug(message)
+
+	items, err := b.items(kind, id)
+	if err != nil {
+		b.logError(kind, id, err)
+		return false
+	}
+	for _, item := range items {
+		for _, sub := range item.Subtitles {
+			if sub.Path == "" || sub.Path != arrPath {
+				continue
+			}
+			query := b.subtitleQuery(kind, item, sub)
+			query.Set("path", sub.Path)
+			if err := b.request(http.MethodDelete, "/api/"+kind+"s/subtitles", query, nil); err != nil {
+				b.logError(kind, id, err)
+				return false
+			}
+			if err := b.request(http.MethodPatch, "/api/"+kind+"s/subtitles", b.subtitleQuery(kind, item, sub), nil); err != nil {
+				b.logError(kind, id, err)
+			}
+			return true
+		}
+	}
+	return b.SearchMissing(path)
+}
+
+// SearchMissing has Bazarr rescan the series or movie a file belongs to and search for its missing subtitles, for
+// when subtitle streams were stripped out of a video
+func (b *Bazarr) SearchMissing(path string) bool {
+	kind, id, ok := b.media(b.translatePath(path))
+	if !ok {
+		return false
+	}
+	resource, idParam := "/api/series", "seriesid"
+	if kind == "movie" {
+		resource, idParam = "/api/movies", "radarrid"
+	}
+	for _, action := range []string{"scan-disk", "search-missing"} {
+		query := url.Values{idParam: {strconv.FormatInt(id, 10)}, "action": {action}}
+		if err := b.request(http.MethodPatch, resource, query, nil); err != nil {
+			b.logError(kind, id, err)
+			return false
+		}
+	}
+	return true
+}
+
+func (b *Bazarr) Connect() (bool, string) {
+	if b.Process {
+		if b.ApiKey != "" {
+			protocol := "http"
+			if b.SSL {
+				protocol = "https"
+			}
+			b.url = strings.TrimSuffix(fmt.Sprintf("%s://%s:%v%v", protocol, b.Address, b.Port, b.BaseURL), "/")
+			b.client = &http.Client{Timeout: 30 * time.Second}
+			b.series = &pathCache[int64]{}
+			b.movies = &pathCache[int64]{}
+			var status struct {
+				Data struct {
+					Version string `json:"bazarr_version"`
+				} `json:"data"`
+			}
+			err := b.request(http.MethodGet, "/api/system/status", nil, &status)
+			if err != nil {
+				return false, err.Error()
+			}
+
+			if status.Data.Version != "" {
+				message := b.Localizer.MustLocalize(&i18n.LocalizeConfig{
+					MessageID: "ArrConnected",
+					TemplateData: map[string]interface{}{
+						"Service": "Bazarr",
+					},
+				})
+				return true, message
+			}
+		} else {
+			message := b.Localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "ArrMissingArgs",
+				TemplateData: map[string]interface{}{
+					"Service": "Bazarr",
+				},
+			})
+			return false, message
+		}
+	}
+	message := b.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "ArrNoOp",
+		TemplateData: map[string]interface{}{
+			"Service": "Bazarr",
+		},
+	})
+	return false, message
+}
+
+// media finds the series or movie an arr path is in. Bazarr lists series by folder and movies by their video file,
+// so movies are keyed by the folder the video is in.
+func (b *Bazarr) media(arrPath string) (string, int64, bool) {
+	if b.series == nil {
+		return "", 0, false
+	}
+	if id, ok := b.series.lookup(arrPath, func() (map[string]int64, error) {
+		var series struct {
+			Data []bazarrMedia `json:"data"`
+		}
+		if err := b.request(http.MethodGet, "/api/series", nil, &series); err != nil {
+			return nil, err
+		}
+		paths := make(map[string]int64, len(series.Data))
+		for _, show := range series.Data {
+			paths[show.Path] = show.SeriesID
+		}
+		return paths, nil
+	}); ok {
+		return "episode", id, true
+	}
+	if id, ok := b.movies.lookup(arrPath, func() (map[string]int64, error) {
+		movies, err := b.items("movie", 0)
+		if err != nil {
+			return nil, err
+		}
+		paths := make(map[string]int64, len(movies))
+		for _, movie := range movies {
+			paths[filepath.Dir(movie.Path)] = movie.RadarrID
+		}
+		return paths, nil
+	}); ok {
+		return "movie", id, true
+	}
+	return "", 0, false
+}
+
+// items lists the episodes of a series, or a movie by its Radarr id, with their subtitles. An id of 0 lists every
+// movie.
+func (b *Bazarr) items(kind string, id int64) ([]bazarrMedia, error) {
+	var list struct {
+		Data []bazarrMedia `json:"data"`
+	}
+	query := url.Values{}
+	resource := "/api/episodes"
+	if kind == "movie" {
+		resource = "/api/movies"
+		if id != 0 {
+			query.Set("radarrid[]", strconv.FormatInt(id, 10))
+		}
+	} else {
+		query.Set("seriesid[]", strconv.FormatInt(id, 10))
+	}
+	err := b.request(http.MethodGet, resource, query, &list)
+	return list.Data, err
+}
+
+// subtitleQuery identifies one subtitle of an episode or movie, the way Bazarr's subtitles endpoints want it
+func (b *Bazarr) subtitleQuery(kind string, item bazarrMedia, sub bazarrSubtitle) url.Values {
+	query := url.Values{
+		"language": {sub.Code2},
+		"forced":   {pythonBool(sub.Forced)},
+		"hi":       {pythonBool(sub.HI)},
+	}
+	if kind == "movie" {
+		query.Set("radarrid", strconv.FormatInt(item.RadarrID, 10))
+	} else {
+		query.Set("seriesid", strconv.FormatInt(item.SeriesID, 10))
+		query.Set("episodeid", strconv.FormatInt(item.EpisodeID, 10))
+	}
+	return query
+}
+
+// pythonBool formats a flag the way Bazarr compares it
+func pythonBool(v bool) string {
+	if v {
+		return "True"
+	}
+	return "False"
+}
+
+func (b *Bazarr) request(method string, resource string, query url.Values, out interface{}) error {
+	if b.client == nil {
+		return errors.New("bazarr is not connected")
+	}
+	target := b.url + resource
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-API-KEY", b.ApiKey)
+	req.Header.Set("Accept", "application/json")
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s %s", method, resource, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (b *Bazarr) logError(kind string, id int64, err error) {
+	message := b.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "ArrErrorDeleting",
+		TemplateData: map[string]interface{}{
+			"Type":  kind,
+			"ID":    id,
+			"Error": err.Error(),
+		},
+	})
+	b.Log.Error(message)
+}
+
+func (b Bazarr) translatePath(path string) string {
+	replaced := remap(path, b.pathMaps, false)
+	if replaced != path {
+		message := b.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "ArrDebugPathMapNew",
+			TemplateData: map[string]interface{}{
+				"Path": replaced,
+			},
+		})
+		b.Log.Debug(message)
+	}
+	return replaced
+}
@@ -2,7 +2,10 @@ package connections
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aetaric/checkrr/logging"
 	"github.com/knadh/koanf/v2"
@@ -13,6 +16,8 @@ import (
 )
 
 type Lidarr struct {
+	// Name is the key of this service under arr in the config
+	Name      string
 	config    *starr.Config
 	server    *lidarr.Lidarr
 	Process   bool
@@ -22,6 +27,8 @@ type Lidarr struct {
 	BaseURL   string
 	SSL       bool
 	pathMaps  map[string]string
+	artists   *pathCache[int64]
+	tracks    *trackCache
 	Log       *logging.Log
 	Localizer *i18n.Localizer
 }
@@ -110,6 +117,98 @@ func (l *Lidarr) RemoveFile(path string) bool {
 	return false
 }
 
+// Rescan has Lidarr rescan the folder a file is in, after checkrr renamed it
+func (l *Lidarr) Rescan(path string) bool {
+	folder := filepath.Dir(l.translatePath(path))
+	l.server.SendCommand(&lidarr.CommandRequest{Name: "RescanFolders", Folders: []string{folder}})
+	return true
+}
+
+// trackCache holds the track durations of each artist that has been looked up, listing every track in the
+// library up front would take two requests per artist
+type trackCache struct {
+	lock    sync.Mutex
+	artists map[int64]*pathCache[time.Duration]
+}
+
+// ExpectedRuntime is the duration Lidarr lists for the track a file holds
+func (l *Lidarr) ExpectedRuntime(path string) (time.Duration, bool) {
+	if l.artists == nil {
+		return 0, false
+	}
+	arrPath := l.translatePath(path)
+	artistID, ok := l.artists.lookup(arrPath, func() (map[string]int64, error) {
+		artists, err := l.server.GetArtist("")
+		if err != nil {
+			return nil, err
+		}
+		ids := make(map[string]int64, len(artists))
+		for _, artist := range artists {
+			ids[artist.Path] = artist.ID
+		}
+		return ids, nil
+	})
+	if !ok {
+		return 0, false
+	}
+
+	l.tracks.lock.Lock()
+	tracks, ok := l.tracks.artists[artistID]
+	if !ok {
+		tracks = &pathCache[time.Duration]{}
+		l.tracks.artists[artistID] = tracks
+	}
+	l.tracks.lock.Unlock()
+
+	runtime, ok := tracks.lookup(arrPath, func() (map[string]time.Duration, error) {
+		trackFiles, err := l.server.GetTrackFilesForArtist(artistID)
+		if err != nil {
+			return nil, err
+		}
+		trackList, err := l.server.GetTracksByArtist(artistID)
+		if err != nil {
+			return nil, err
+		}
+		durations := make(map[int64]time.Duration, len(trackList))
+		for _, track := range trackList {
+			if track.TrackFileID != 0 {
+				durations[track.TrackFileID] = time.Duration(track.Duration) * time.Millisecond
+			}
+		}
+		runtimes := make(map[string]time.Duration, len(trackFiles))
+		for _, trackFile := range trackFiles {
+			runtimes[trackFile.Path] = durations[trackFile.ID]
+		}
+		return runtimes, nil
+	})
+	return runtime, ok && runtime > 0
+}
+
+// QueuedPaths lists the paths, as checkrr sees them, that Lidarr is downloading to or importing into. That is the
+// download output path of every queued album and the track files an upgrade would replace.
+func (l *Lidarr) QueuedPaths() ([]string, error) {
+	queue, err := l.server.GetQueue(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	albums := map[int64]bool{}
+	for _, record := range queue.Records {
+		if record.OutputPath != "" {
+			paths = append(paths, l.LocalPath(record.OutputPath))
+		}
+		if record.AlbumID != 0 && !albums[record.AlbumID] {
+			albums[record.AlbumID] = true
+			if files, err := l.server.GetTrackFilesForAlbum(record.AlbumID); err == nil {
+				for _, file := range files {
+					paths = append(paths, l.LocalPath(file.Path))
+				}
+			}
+		}
+	}
+	return paths, nil
+}
+
 func (l *Lidarr) Connect() (bool, string) {
 	if l.Process {
 		if l.ApiKey != "" {
@@ -119,6 +218,8 @@ func (l *Lidarr) Connect() (bool, string) {
 			}
 			l.config = starr.New(l.ApiKey, fmt.Sprintf("%s://%s:%v%v", protocol, l.Address, l.Port, l.BaseURL), 0)
 			l.server = lidarr.New(l.config)
+			l.artists = &pathCache[int64]{}
+			l.tracks = &trackCache{artists: map[int64]*pathCache[time.Duration]{}}
 			status, err := l.server.GetSystemStatus()
 			if err != nil {
 				return false, err.Error()
@@ -152,6 +253,11 @@ func (l *Lidarr) Connect() (bool, string) {
 	return false, message
 }
 
+// LocalPath maps a path as Lidarr sees it, like the ones in its webhooks, back to the path checkrr sees
+func (l Lidarr) LocalPath(path string) string {
+	return remap(path, l.pathMaps, true)
+}
+
 func (l Lidarr) translatePath(path string) string {
 	keys := make([]string, 0, len(l.pathMaps))
 	for k := range l.pathMaps {
@@ -3,6 +3,7 @@ package connections
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/aetaric/checkrr/logging"
 	"github.com/knadh/koanf/v2"
@@ -13,6 +14,8 @@ import (
 )
 
 type Radarr struct {
+	// Name is the key of this service under arr in the config
+	Name      string
 	config    *starr.Config
 	server    *radarr.Radarr
 	Process   bool
@@ -22,6 +25,7 @@ type Radarr struct {
 	BaseURL   string
 	SSL       bool
 	pathMaps  map[string]string
+	runtimes  *pathCache[time.Duration]
 	Log       *logging.Log
 	Localizer *i18n.Localizer
 }
@@ -107,6 +111,58 @@ func (r *Radarr) RemoveFile(path string) bool {
 	return false
 }
 
+// Rescan has Radarr rescan the movie a file belongs to, after checkrr renamed it
+func (r *Radarr) Rescan(path string) bool {
+	movieList, _ := r.server.GetMovie(&radarr.GetMovie{TMDBID: 0})
+	for _, movie := range movieList {
+		if within(r.translatePath(path), movie.Path) {
+			r.server.SendCommand(&radarr.CommandRequest{Name: "RescanMovie", MovieIDs: []int64{movie.ID}})
+			return true
+		}
+	}
+	return false
+}
+
+// ExpectedRuntime is the runtime Radarr lists for the movie a file belongs to
+func (r *Radarr) ExpectedRuntime(path string) (time.Duration, bool) {
+	if r.runtimes == nil {
+		return 0, false
+	}
+	runtime, ok := r.runtimes.lookup(r.translatePath(path), func() (map[string]time.Duration, error) {
+		movieList, err := r.server.GetMovie(&radarr.GetMovie{TMDBID: 0})
+		if err != nil {
+			return nil, err
+		}
+		runtimes := make(map[string]time.Duration, len(movieList))
+		for _, movie := range movieList {
+			runtimes[movie.Path] = time.Duration(movie.Runtime) * time.Minute
+		}
+		return runtimes, nil
+	})
+	return runtime, ok && runtime > 0
+}
+
+// QueuedPaths lists the paths, as checkrr sees them, that Radarr is downloading to or importing into. That is the
+// download output path of every queued movie and the movie file an upgrade would replace.
+func (r *Radarr) QueuedPaths() ([]string, error) {
+	queue, err := r.server.GetQueue(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, record := range queue.Records {
+		if record.OutputPath != "" {
+			paths = append(paths, r.LocalPath(record.OutputPath))
+		}
+		if record.MovieID != 0 {
+			if movie, err := r.server.GetMovieByID(record.MovieID); err == nil && movie.MovieFile != nil && movie.MovieFile.Path != "" {
+				paths = append(paths, r.LocalPath(movie.MovieFile.Path))
+			}
+		}
+	}
+	return paths, nil
+}
+
 func (r *Radarr) Connect() (bool, string) {
 	if r.Process {
 		if r.ApiKey != "" {
@@ -116,6 +172,7 @@ func (r *Radarr) Connect() (bool, string) {
 			}
 			r.config = starr.New(r.ApiKey, fmt.Sprintf("%s://%s:%v%v", protocol, r.Address, r.Port, r.BaseURL), 0)
 			r.server = radarr.New(r.config)
+			r.runtimes = &pathCache[time.Duration]{}
 			status, err := r.server.GetSystemStatus()
 			if err != nil {
 				return false, err.Error()
@@ -149,6 +206,11 @@ func (r *Radarr) Connect() (bool, string) {
 	return false, message
 }
 
+// LocalPath maps a path as Radarr sees it, like the ones in its webhooks, back to the path checkrr sees
+func (r Radarr) LocalPath(path string) string {
+	return remap(path, r.pathMaps, true)
+}
+
 func (r Radarr) translatePath(path string) string {
 	keys := make([]string, 0, len(r.pathMaps))
 	for k := range r.pathMaps {
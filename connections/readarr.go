@@ -0,0 +1,263 @@
+package connections
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/aetaric/checkrr/logging"
+	"github.com/knadh/koanf/v2"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+
+	"golift.io/starr"
+	"golift.io/starr/readarr"
+)
+
+type Readarr struct {
+	// Name is the key of this service under arr in the config
+	Name      string
+	config    *starr.Config
+	server    *readarr.Readarr
+	Process   bool
+	ApiKey    string
+	Address   string
+	Port      int
+	BaseURL   string
+	SSL       bool
+	pathMaps  map[string]string
+	authors   *pathCache[int64]
+	Log       *logging.Log
+	Localizer *i18n.Localizer
+}
+
+func (r *Readarr) FromConfig(conf *koanf.Koanf) {
+	if conf != nil {
+		r.Address = conf.String("address")
+		r.Process = conf.Bool("process")
+		r.ApiKey = conf.String("apikey")
+		r.Port = conf.Int("port")
+		r.BaseURL = conf.String("baseurl")
+		r.pathMaps = conf.StringMap("mappings")
+		r.SSL = conf.Bool("ssl")
+		r.Log.Debugf("Readarr Path Maps: %v", r.pathMaps)
+	} else {
+		r.Process = false
+	}
+}
+
+func (r *Readarr) MatchPath(path string) bool {
+	readarrFolders, _ := r.server.GetRootFolders()
+	for _, folder := range readarrFolders {
+		message := r.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "ArrDebugCheckingPaths",
+			TemplateData: map[string]interface{}{
+				"Service":    "readarr",
+				"RootFolder": folder.Path,
+				"File":       path,
+			},
+		})
+		r.Log.Debug(message)
+		if strings.Contains(r.translatePath(path), folder.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Readarr) RemoveFile(path string) bool {
+	arrPath := r.translatePath(path)
+	authorID, ok := r.authors.lookup(arrPath, r.authorPaths)
+	if !ok {
+		return false
+	}
+
+	bookFiles, _ := r.server.GetBookFilesForAuthor(authorID)
+	for _, bookFile := range bookFiles {
+		if bookFile.Path != arrPath {
+			continue
+		}
+		message := r.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "ArrDebugMatchedMedia",
+			TemplateData: map[string]interface{}{
+				"Type": "book",
+				"ID":   bookFile.BookID,
+				"Path": path,
+			},
+		})
+		r.Log.Debug(message)
+		message = r.Localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "ArrDebugMatchedID",
+			TemplateData: map[string]interface{}{
+				"Type": "book",
+				"ID":   bookFile.ID,
+			},
+		})
+		r.Log.Debug(message)
+
+		err := r.server.DeleteBookFile(bookFile.ID)
+		if err != nil {
+			message := r.Localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "ArrErrorDeleting",
+				TemplateData: map[string]interface{}{
+					"Type":  "book",
+					"ID":    bookFile.ID,
+					"Error": err.Error(),
+				},
+			})
+			r.Log.Error(message)
+			return false
+		}
+		r.server.SendCommand(&readarr.CommandRequest{Name: "BookSearch", BookIDs: []int64{bookFile.BookID}})
+		return true
+	}
+	return false
+}
+
+// Rescan has Readarr rescan the folder a file is in, after checkrr renamed it. starr's command request has no
+// folders field, so the command is posted directly.
+func (r *Readarr) Rescan(path string) bool {
+	var body bytes.Buffer
+	command := map[string]interface{}{"name": "RescanFolders", "folders": []string{filepath.Dir(r.translatePath(path))}}
+	if err := json.NewEncoder(&body).Encode(command); err != nil {
+		return false
+	}
+	err := r.server.PostInto(context.Background(), starr.Request{URI: "v1/command", Body: &body}, nil)
+	return err == nil
+}
+
+// authorPaths lists every author folder, starr only fetches authors one at a time
+func (r *Readarr) authorPaths() (map[string]int64, error) {
+	var authors []*readarr.Author
+	err := r.server.GetInto(context.Background(), starr.Request{URI: "v1/author"}, &authors)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]int64, len(authors))
+	for _, author := range authors {
+		ids[author.Path] = author.ID
+	}
+	return ids, nil
+}
+
+// QueuedPaths lists the paths, as checkrr sees them, that Readarr is downloading to or importing into. That is the
+// download output path of every queued book and the book files an upgrade would replace.
+func (r *Readarr) QueuedPaths() ([]string, error) {
+	queue, err := r.server.GetQueue(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	var bookIDs []int64
+	for _, record := range queue.Records {
+		if record.OutputPath != "" {
+			paths = append(paths, r.LocalPath(record.OutputPath))
+		}
+		if record.BookID != 0 && !slices.Contains(bookIDs, record.BookID) {
+			bookIDs = append(bookIDs, record.BookID)
+		}
+	}
+	if len(bookIDs) > 0 {
+		files, err := r.server.GetBookFilesForBook(bookIDs...)
+		if err != nil {
+			return paths, err
+		}
+		for _, file := range files {
+			paths = append(paths, r.LocalPath(file.Path))
+		}
+	}
+	return paths, nil
+}
+
+func (r *Readarr) Connect() (bool, string) {
+	if r.Process {
+		if r.ApiKey != "" {
+			protocol := "http"
+			if r.SSL {
+				protocol = "https"
+			}
+			r.config = starr.New(r.ApiKey, fmt.Sprintf("%s://%s:%v%v", protocol, r.Address, r.Port, r.BaseURL), 0)
+			r.server = readarr.New(r.config)
+			r.authors = &pathCache[int64]{}
+			status, err := r.server.GetSystemStatus()
+			if err != nil {
+				return false, err.Error()
+			}
+
+			if status.Version != "" {
+				message := r.Localizer.MustLocalize(&i18n.LocalizeConfig{
+					MessageID: "ArrConnected",
+					TemplateData: map[string]interface{}{
+						"Service": "Readarr",
+					},
+				})
+				return true, message
+			}
+		} else {
+			message := r.Localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "ArrMissingArgs",
+				TemplateData: map[string]interface{}{
+					"Service": "Readarr",
+				},
+			})
+			return false, message
+		}
+	}
+	message := r.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "ArrNoOp",
+		TemplateData: map[string]interface{}{
+			"Service": "Readarr",
+		},
+	})
+	return false, message
+}
+
+// LocalPath maps a path as Readarr sees it, like the ones in its webhooks, back to the path checkrr sees
+func (r Readarr) LocalPath(path string) string {
+	return remap(path, r.pathMaps, true)
+}
+
+func (r Readarr) translatePath(path string) string {
+	keys := make([]string, 0, len(r.pathMaps))
+	for k := range r.pathMaps {
+		keys = append(keys, k)
+	}
+	for _, key := range keys {
+		if strings.Contains(path, r.pathMaps[key]) {
+			message := r.Localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "ArrDebugPathMapKey",
+				TemplateData: map[string]interface{}{
+					"Key": key,
+				},
+			})
+			r.Log.Debug(message)
+			message = r.Localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "ArrDebugPathMapValue",
+				TemplateData: map[string]interface{}{
+					"Value": r.pathMaps[key],
+				},
+			})
+			r.Log.Debug(message)
+			message = r.Localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "ArrDebugPathMapOriginal",
+				TemplateData: map[string]interface{}{
+					"Path": path,
+				},
+			})
+			r.Log.Debug(message)
+			replaced := strings.Replace(path, r.pathMaps[key], key, -1)
+			message = r.Localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "ArrDebugPathMapNew",
+				TemplateData: map[string]interface{}{
+					"Path": replaced,
+				},
+			})
+			r.Log.Debug(message)
+			return replaced
+		}
+	}
+	return path
+}
@@ -0,0 +1,87 @@
+package connections
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// pathCacheRefresh is how long a fetched listing is trusted before the arr is asked again
+const pathCacheRefresh = time.Hour
+
+// pathCacheRetry is how long a cache waits after a failed fetch before asking the arr again, so an arr that is down
+// isn't hit once for every checked file
+const pathCacheRetry = 5 * time.Minute
+
+// pathCache keeps a listing from an arr keyed by the path it reports for each series, movie, artist or track, so
+// looking up every checked file doesn't turn into a full library listing per file
+type pathCache[T any] struct {
+	lock    sync.Mutex
+	fetched time.Time
+	failed  time.Time
+	paths   map[string]T
+}
+
+// lookup returns the value for the arr path itself, or for the longest folder in the cache that contains it,
+// refreshing the cache with fetch when it is stale. After a failed fetch the stale listing, if there is one, is used
+// until pathCacheRetry has passed.
+func (p *pathCache[T]) lookup(arrPath string, fetch func() (map[string]T, error)) (T, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var value T
+	if (p.paths == nil || time.Since(p.fetched) > pathCacheRefresh) && time.Since(p.failed) > pathCacheRetry {
+		paths, err := fetch()
+		if err != nil {
+			p.failed = time.Now()
+		} else {
+			p.paths = paths
+			p.fetched = time.Now()
+		}
+	}
+	if p.paths == nil {
+		return value, false
+	}
+
+	if exact, ok := p.paths[arrPath]; ok {
+		return exact, true
+	}
+	found := false
+	longest := -1
+	for folder, folderValue := range p.paths {
+		if len(folder) > longest && within(arrPath, folder) {
+			value = folderValue
+			longest = len(folder)
+			found = true
+		}
+	}
+	return value, found
+}
+
+// within reports whether path is inside folder, a folder named like the start of another doesn't count
+func within(path string, folder string) bool {
+	folder = strings.TrimRight(folder, "/\\")
+	return folder != "" && len(path) > len(folder) && strings.HasPrefix(path, folder) &&
+		strings.ContainsRune("/\\", rune(path[len(folder)]))
+}
+
+// remap moves a path from one side of an arr's mappings to the other. The mappings are keyed by the arr path with
+// the local path as the value, toLocal picks the direction. When mappings overlap the longest matching prefix wins,
+// so the result doesn't depend on map order.
+func remap(path string, pathMaps map[string]string, toLocal bool) string {
+	from, to, longest := "", "", -1
+	for arrPath, localPath := range pathMaps {
+		prefix, replacement := localPath, arrPath
+		if toLocal {
+			prefix, replacement = arrPath, localPath
+		}
+		prefix = strings.TrimRight(prefix, "/\\")
+		if len(prefix) > longest && (path == prefix || within(path, prefix)) {
+			from, to, longest = prefix, strings.TrimRight(replacement, "/\\"), len(prefix)
+		}
+	}
+	if longest < 0 {
+		return path
+	}
+	return to + path[len(from):]
+}
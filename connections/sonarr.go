@@ -1,8 +1,13 @@
 package connections
 
 import (
+	"context"
 	"fmt"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aetaric/checkrr/logging"
 	"github.com/knadh/koanf/v2"
@@ -13,6 +18,8 @@ import (
 )
 
 type Sonarr struct {
+	// Name is the key of this service under arr in the config
+	Name      string
 	config    *starr.Config
 	server    *sonarr.Sonarr
 	Process   bool
@@ -22,6 +29,8 @@ type Sonarr struct {
 	BaseURL   string
 	SSL       bool
 	pathMaps  map[string]string
+	series    *pathCache[sonarrSeries]
+	episodes  *episodeRuntimes
 	Log       *logging.Log
 	Localizer *i18n.Localizer
 }
@@ -92,6 +101,129 @@ func (s *Sonarr) RemoveFile(path string) bool {
 	return false
 }
 
+// Rescan has Sonarr rescan the series a file belongs to, after checkrr renamed it
+func (s *Sonarr) Rescan(path string) bool {
+	seriesList, _ := s.server.GetAllSeries()
+	for _, series := range seriesList {
+		if within(s.translatePath(path), series.Path) {
+			s.server.SendCommand(&sonarr.CommandRequest{Name: "RescanSeries", SeriesID: series.ID})
+			return true
+		}
+	}
+	return false
+}
+
+// sonarrSeries is what ExpectedRuntime needs to know about a series
+type sonarrSeries struct {
+	id      int64
+	runtime time.Duration
+}
+
+// sonarrEpisode is the part of an episode starr doesn't decode, newer Sonarr versions list a runtime per episode
+type sonarrEpisode struct {
+	EpisodeFileID int64 `json:"episodeFileId"`
+	Runtime       int   `json:"runtime"`
+}
+
+// episodeRuntimes caches episode runtimes per series ID
+type episodeRuntimes struct {
+	lock   sync.Mutex
+	series map[int64]*pathCache[time.Duration]
+}
+
+// ExpectedRuntime is the runtime Sonarr lists for the episode a file holds, or for its series when Sonarr doesn't
+// know one for the episode.
+func (s *Sonarr) ExpectedRuntime(path string) (time.Duration, bool) {
+	if s.series == nil {
+		return 0, false
+	}
+	arrPath := s.translatePath(path)
+	series, ok := s.series.lookup(arrPath, func() (map[string]sonarrSeries, error) {
+		seriesList, err := s.server.GetAllSeries()
+		if err != nil {
+			return nil, err
+		}
+		found := make(map[string]sonarrSeries, len(seriesList))
+		for _, series := range seriesList {
+			found[series.Path] = sonarrSeries{id: series.ID, runtime: time.Duration(series.Runtime) * time.Minute}
+		}
+		return found, nil
+	})
+	if !ok {
+		return 0, false
+	}
+	if runtime, ok := s.episodeRuntime(series.id, arrPath); ok && runtime > 0 {
+		return runtime, true
+	}
+	return series.runtime, series.runtime > 0
+}
+
+// episodeRuntime looks up the runtime of the episode in an episode file, through a cache per series
+func (s *Sonarr) episodeRuntime(seriesID int64, arrPath string) (time.Duration, bool) {
+	s.episodes.lock.Lock()
+	cache, ok := s.episodes.series[seriesID]
+	if !ok {
+		cache = &pathCache[time.Duration]{}
+		s.episodes.series[seriesID] = cache
+	}
+	s.episodes.lock.Unlock()
+
+	return cache.lookup(arrPath, func() (map[string]time.Duration, error) {
+		files, err := s.server.GetSeriesEpisodeFiles(seriesID)
+		if err != nil {
+			return nil, err
+		}
+		var episodes []sonarrEpisode
+		req := starr.Request{URI: "v3/episode", Query: url.Values{"seriesId": {strconv.FormatInt(seriesID, 10)}}}
+		if err := s.server.GetInto(context.Background(), req, &episodes); err != nil {
+			return nil, err
+		}
+		runtimes := make(map[int64]time.Duration, len(episodes))
+		for _, episode := range episodes {
+			// a file holding several episodes runs as long as all of them
+			runtimes[episode.EpisodeFileID] += time.Duration(episode.Runtime) * time.Minute
+		}
+		found := make(map[string]time.Duration, len(files))
+		for _, file := range files {
+			if runtime := runtimes[file.ID]; runtime > 0 {
+				found[file.Path] = runtime
+			}
+		}
+		return found, nil
+	})
+}
+
+// QueuedPaths lists the paths, as checkrr sees them, that Sonarr is downloading to or importing into. That is the
+// download output path of every queued episode and the episode file an upgrade would replace.
+func (s *Sonarr) QueuedPaths() ([]string, error) {
+	queue, err := s.server.GetQueue(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	var fileIDs []int64
+	for _, record := range queue.Records {
+		if record.OutputPath != "" {
+			paths = append(paths, s.LocalPath(record.OutputPath))
+		}
+		if record.EpisodeID != 0 {
+			if episode, err := s.server.GetEpisodeByID(record.EpisodeID); err == nil && episode.EpisodeFileID != 0 {
+				fileIDs = append(fileIDs, episode.EpisodeFileID)
+			}
+		}
+	}
+	if len(fileIDs) > 0 {
+		files, err := s.server.GetEpisodeFiles(fileIDs...)
+		if err != nil {
+			return paths, err
+		}
+		for _, file := range files {
+			paths = append(paths, s.LocalPath(file.Path))
+		}
+	}
+	return paths, nil
+}
+
 func (s *Sonarr) Connect() (bool, string) {
 	if s.Process {
 		if s.ApiKey != "" {
@@ -101,6 +233,8 @@ func (s *Sonarr) Connect() (bool, string) {
 			}
 			s.config = starr.New(s.ApiKey, fmt.Sprintf("%s://%s:%v%v", protocol, s.Address, s.Port, s.BaseURL), 0)
 			s.server = sonarr.New(s.config)
+			s.series = &pathCache[sonarrSeries]{}
+			s.episodes = &episodeRuntimes{series: make(map[int64]*pathCache[time.Duration])}
 			status, err := s.server.GetSystemStatus()
 			if err != nil {
 				return false, err.Error()
@@ -134,6 +268,11 @@ func (s *Sonarr) Connect() (bool, string) {
 	return false, message
 }
 
+// LocalPath maps a path as Sonarr sees it, like the ones in its webhooks, back to the path checkrr sees
+func (s Sonarr) LocalPath(path string) string {
+	return remap(path, s.pathMaps, true)
+}
+
 func (s Sonarr) translatePath(path string) string {
 	keys := make([]string, 0, len(s.pathMaps))
 	for k := range s.pathMaps {
@@ -3,6 +3,7 @@ package features
 import (
 	"encoding/csv"
 	"os"
+	"sync"
 
 	"github.com/aetaric/checkrr/logging"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
@@ -14,6 +15,7 @@ type CSV struct {
 	FilePath   string
 	fileHandle *os.File
 	fileWriter *csv.Writer
+	mu         sync.Mutex
 	Log        *logging.Log
 	Localizer  *i18n.Localizer
 }
@@ -34,12 +36,16 @@ func (c *CSV) Open() {
 }
 
 func (c *CSV) Write(path string, t string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.fileWriter.Write([]string{path, t})
 	c.fileWriter.Flush()
 	c.Log.Debug("wrote csv entry")
 }
 
 func (c *CSV) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.fileWriter.Flush()
 	c.fileHandle.Sync()
 	c.fileHandle.Close()
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
@@ -21,30 +22,33 @@ import (
 )
 
 type Stats struct {
-	influxdb1         influxdb2.Client     `json:"-"`
-	writeAPI1         api.WriteAPIBlocking `json:"-"`
-	influxdb2         influxdb2.Client     `json:"-"`
-	writeAPI2         api.WriteAPIBlocking `json:"-"`
-	config            koanf.Koanf          `json:"-"`
-	Log               logging.Log          `json:"-"`
-	splunk            Splunk               `json:"-"`
-	splunkConfigured  bool                 `json:"-"`
-	SonarrSubmissions uint64               `json:"sonarrSubmissions"`
-	RadarrSubmissions uint64               `json:"radarrSubmissions"`
-	LidarrSubmissions uint64               `json:"lidarrSubmissions"`
-	FilesChecked      uint64               `json:"filesChecked"`
-	HashMatches       uint64               `json:"hashMatches"`
-	HashMismatches    uint64               `json:"hashMismatches"`
-	VideoFiles        uint64               `json:"videoFiles"`
-	AudioFiles        uint64               `json:"audioFiles"`
-	UnknownFileCount  uint64               `json:"unknownFileCount"`
-	NonVideo          uint64               `json:"nonVideo"`
-	Running           bool                 `json:"running"`
-	startTime         time.Time            `json:"-"`
-	endTime           time.Time            `json:"-"`
-	Diff              time.Duration        `json:"timeDiff"`
-	DB                *bolt.DB             `json:"-"`
-	Localizer         *i18n.Localizer      `json:"-"`
+	influxdb1          influxdb2.Client     `json:"-"`
+	writeAPI1          api.WriteAPIBlocking `json:"-"`
+	influxdb2          influxdb2.Client     `json:"-"`
+	writeAPI2          api.WriteAPIBlocking `json:"-"`
+	config             koanf.Koanf          `json:"-"`
+	Log                logging.Log          `json:"-"`
+	splunk             Splunk               `json:"-"`
+	splunkConfigured   bool                 `json:"-"`
+	mu                 sync.Mutex           `json:"-"`
+	SonarrSubmissions  uint64               `json:"sonarrSubmissions"`
+	RadarrSubmissions  uint64               `json:"radarrSubmissions"`
+	LidarrSubmissions  uint64               `json:"lidarrSubmissions"`
+	ReadarrSubmissions uint64               `json:"readarrSubmissions"`
+	FilesChecked       uint64               `json:"filesChecked"`
+	HashMatches        uint64               `json:"hashMatches"`
+	HashMismatches     uint64               `json:"hashMismatches"`
+	VideoFiles         uint64               `json:"videoFiles"`
+	AudioFiles         uint64               `json:"audioFiles"`
+	UnknownFileCount   uint64               `json:"unknownFileCount"`
+	NonVideo           uint64               `json:"nonVideo"`
+	Running            bool                 `json:"running"`
+	Cancelled          bool                 `json:"cancelled"`
+	startTime          time.Time            `json:"-"`
+	endTime            time.Time            `json:"-"`
+	Diff               time.Duration        `json:"timeDiff"`
+	DB                 *bolt.DB             `json:"-"`
+	Localizer          *i18n.Localizer      `json:"-"`
 }
 
 type SplunkStats struct {
@@ -54,16 +58,17 @@ type SplunkStats struct {
 }
 
 type SplunkFields struct {
-	SonarrSubmissions uint64 `json:"metric_name:checkrr.sonarrSubmissions"`
-	RadarrSubmissions uint64 `json:"metric_name:checkrr.radarrSubmissions"`
-	LidarrSubmissions uint64 `json:"metric_name:checkrr.lidarrSubmissions"`
-	FilesChecked      uint64 `json:"metric_name:checkrr.filesChecked"`
-	HashMatches       uint64 `json:"metric_name:checkrr.hashMatches"`
-	HashMismatches    uint64 `json:"metric_name:checkrr.hashMismatches"`
-	VideoFiles        uint64 `json:"metric_name:checkrr.videoFiles"`
-	AudioFiles        uint64 `json:"metric_name:checkrr.audioFiles"`
-	UnknownFileCount  uint64 `json:"metric_name:checkrr.unknownFileCount"`
-	NonVideo          uint64 `json:"metric_name:checkrr.nonVideo"`
+	SonarrSubmissions  uint64 `json:"metric_name:checkrr.sonarrSubmissions"`
+	RadarrSubmissions  uint64 `json:"metric_name:checkrr.radarrSubmissions"`
+	LidarrSubmissions  uint64 `json:"metric_name:checkrr.lidarrSubmissions"`
+	ReadarrSubmissions uint64 `json:"metric_name:checkrr.readarrSubmissions"`
+	FilesChecked       uint64 `json:"metric_name:checkrr.filesChecked"`
+	HashMatches        uint64 `json:"metric_name:checkrr.hashMatches"`
+	HashMismatches     uint64 `json:"metric_name:checkrr.hashMismatches"`
+	VideoFiles         uint64 `json:"metric_name:checkrr.videoFiles"`
+	AudioFiles         uint64 `json:"metric_name:checkrr.audioFiles"`
+	UnknownFileCount   uint64 `json:"metric_name:checkrr.unknownFileCount"`
+	NonVideo           uint64 `json:"metric_name:checkrr.nonVideo"`
 }
 
 type Splunk struct {
@@ -122,71 +127,73 @@ func (s *Stats) FromConfig(config koanf.Koanf) {
 }
 
 func (s *Stats) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.startTime = time.Now()
 	s.Running = true
-	// Update stats DB
+	s.putCurrent()
+}
+
+// Stop ends a run, updating current-stats and keeping a copy of it in the run history
+func (s *Stats) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stop()
 	err := s.DB.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte("Checkrr-stats"))
 		marshal, er := json.Marshal(s)
 		if er != nil {
 			return er
 		}
-		err := b.Put([]byte("current-stats"), marshal)
+		now := time.Now().UTC()
+		err := b.Put([]byte(now.Format(time.RFC3339)), marshal)
 		return err
 	})
 	if err != nil {
-		message := s.Localizer.MustLocalize(&i18n.LocalizeConfig{
-			MessageID: "DBFailure",
-			TemplateData: map[string]interface{}{
-				"Error": err.Error(),
-			},
-		})
-		s.Log.WithFields(log.Fields{"Module": "Stats", "DB Update": "Failure"}).Warn(message)
+		s.logDBFailure(err)
 	}
 }
 
-func (s *Stats) Stop() {
+// StopBatch ends a batch of files checked outside a run, from watch mode or an import. It updates current-stats but
+// leaves the run history alone, so a busy import period doesn't fill it with tiny runs.
+func (s *Stats) StopBatch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stop()
+}
+
+// stop marks the run or batch as over and updates current-stats. s.mu has to be held.
+func (s *Stats) stop() {
 	s.endTime = time.Now()
 	s.Diff = s.endTime.Sub(s.startTime)
 	s.Running = false
-	// Update stats DB
+	s.putCurrent()
+}
+
+// putCurrent stores the stats as current-stats. s.mu has to be held, so the last change to the counters is always
+// the last one written.
+func (s *Stats) putCurrent() {
 	err := s.DB.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte("Checkrr-stats"))
 		marshal, er := json.Marshal(s)
 		if er != nil {
 			return er
 		}
-		err := b.Put([]byte("current-stats"), marshal)
-		return err
+		return b.Put([]byte("current-stats"), marshal)
 	})
 	if err != nil {
-		message := s.Localizer.MustLocalize(&i18n.LocalizeConfig{
-			MessageID: "DBFailure",
-			TemplateData: map[string]interface{}{
-				"Error": err.Error(),
-			},
-		})
-		s.Log.WithFields(log.Fields{"Module": "Stats", "DB Update": "Failure"}).Warn(message)
+		s.logDBFailure(err)
 	}
-	err = s.DB.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("Checkrr-stats"))
-		marshal, er := json.Marshal(s)
-		if er != nil {
-			return er
-		}
-		now := time.Now().UTC()
-		err := b.Put([]byte(now.Format(time.RFC3339)), marshal)
-		return err
+}
+
+func (s *Stats) logDBFailure(err error) {
+	message := s.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "DBFailure",
+		TemplateData: map[string]interface{}{
+			"Error": err.Error(),
+		},
 	})
-	if err != nil {
-		message := s.Localizer.MustLocalize(&i18n.LocalizeConfig{
-			MessageID: "DBFailure",
-			TemplateData: map[string]interface{}{
-				"Error": err.Error(),
-			},
-		})
-		s.Log.WithFields(log.Fields{"Module": "Stats", "DB Update": "Failure"}).Warn(message)
-	}
+	s.Log.WithFields(log.Fields{"Module": "Stats", "DB Update": "Failure"}).Warn(message)
 }
 
 func (s *Stats) Render() {
@@ -210,6 +217,9 @@ func (s *Stats) Render() {
 	lidarrSubmissions := s.Localizer.MustLocalize(&i18n.LocalizeConfig{
 		MessageID: "StatsLidarrSubmissions",
 	})
+	readarrSubmissions := s.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "StatsReadarrSubmissions",
+	})
 	videoFiles := s.Localizer.MustLocalize(&i18n.LocalizeConfig{
 		MessageID: "StatsVideoFiles",
 	})
@@ -232,6 +242,7 @@ func (s *Stats) Render() {
 		{sonarrSubmissions, s.SonarrSubmissions},
 		{radarrSubmissions, s.RadarrSubmissions},
 		{lidarrSubmissions, s.LidarrSubmissions},
+		{readarrSubmissions, s.ReadarrSubmissions},
 		{videoFiles, s.VideoFiles},
 		{audioFiles, s.AudioFiles},
 		{nonVideo, s.NonVideo},
@@ -241,7 +252,110 @@ func (s *Stats) Render() {
 	t.Render()
 }
 
-func (s *Stats) Write(field string, count uint64) {
+// counterFields are the names Increment takes, one per counter
+var counterFields = []string{"FilesChecked", "HashMatches", "HashMismatches", "VideoFiles", "AudioFiles", "NonVideo",
+	"UnknownFiles", "Sonarr", "Radarr", "Lidarr", "Readarr"}
+
+// counter returns the counter that backs field, or nil for a field that isn't one. s.mu has to be held.
+func (s *Stats) counter(field string) *uint64 {
+	switch field {
+	case "FilesChecked":
+		return &s.FilesChecked
+	case "HashMatches":
+		return &s.HashMatches
+	case "HashMismatches":
+		return &s.HashMismatches
+	case "VideoFiles":
+		return &s.VideoFiles
+	case "AudioFiles":
+		return &s.AudioFiles
+	case "NonVideo":
+		return &s.NonVideo
+	case "UnknownFiles":
+		return &s.UnknownFileCount
+	case "Sonarr":
+		return &s.SonarrSubmissions
+	case "Radarr":
+		return &s.RadarrSubmissions
+	case "Lidarr":
+		return &s.LidarrSubmissions
+	case "Readarr":
+		return &s.ReadarrSubmissions
+	}
+	return nil
+}
+
+// Counters returns every counter by the name Increment takes
+func (s *Stats) Counters() map[string]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[string]uint64, len(counterFields))
+	for _, field := range counterFields {
+		counts[field] = *s.counter(field)
+	}
+	return counts
+}
+
+// Checkpoint returns the stats with the elapsed time filled in, for a run that may need resuming. counts are the
+// counters as they were at the checkpoint, files checked since then are counted again on resume.
+func (s *Stats) Checkpoint(counts map[string]uint64) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	live := make(map[string]uint64, len(counts))
+	for field, count := range counts {
+		if counter := s.counter(field); counter != nil {
+			live[field] = *counter
+			*counter = count
+		}
+	}
+	s.Diff = time.Since(s.startTime)
+	data, err := json.Marshal(s)
+	for field, count := range live {
+		*s.counter(field) = count
+	}
+	return data, err
+}
+
+// Resume picks the counters and elapsed time back up from a Checkpoint, so an interrupted run and its resumption
+// end up as one stats record. It takes the place of Start.
+func (s *Stats) Resume(checkpoint []byte) error {
+	s.mu.Lock()
+	err := json.Unmarshal(checkpoint, s)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.Start()
+	s.startTime = s.startTime.Add(-s.Diff)
+	return nil
+}
+
+// Increment bumps the counter that backs field and writes it out. Check workers
+// run concurrently, so every counter change needs to go through here. current-stats
+// is written under the lock so it never goes back to an older count, the metrics
+// are sent after it is released so a slow InfluxDB doesn't hold up every other worker.
+func (s *Stats) Increment(field string) {
+	s.mu.Lock()
+
+	counter := s.counter(field)
+	if counter == nil {
+		s.mu.Unlock()
+		s.Log.Warnf("unknown stats field %s", field)
+		return
+	}
+	*counter++
+	count := *counter
+	splunkfields := SplunkFields{FilesChecked: s.FilesChecked, HashMatches: s.HashMatches, HashMismatches: s.HashMismatches,
+		SonarrSubmissions: s.SonarrSubmissions, RadarrSubmissions: s.RadarrSubmissions, LidarrSubmissions: s.LidarrSubmissions,
+		ReadarrSubmissions: s.ReadarrSubmissions,
+		VideoFiles:         s.VideoFiles, NonVideo: s.NonVideo, AudioFiles: s.AudioFiles, UnknownFileCount: s.UnknownFileCount}
+	s.putCurrent()
+	s.mu.Unlock()
+	s.Write(field, count, splunkfields)
+}
+
+// Write sends a counter to the configured metrics systems. splunkfields is a copy of the counters taken under the lock.
+func (s *Stats) Write(field string, count uint64, splunkfields SplunkFields) {
 	// Send to influxdb if enabled
 	if s.writeAPI1 != nil {
 		p := influxdb2.NewPointWithMeasurement("checkrr").
@@ -264,9 +378,6 @@ func (s *Stats) Write(field string, count uint64) {
 	// Send to splunk if configured
 	if s.splunkConfigured {
 		t := time.Now().Unix()
-		splunkfields := SplunkFields{FilesChecked: s.FilesChecked, HashMatches: s.HashMatches, HashMismatches: s.HashMismatches,
-			SonarrSubmissions: s.SonarrSubmissions, RadarrSubmissions: s.RadarrSubmissions, LidarrSubmissions: s.LidarrSubmissions,
-			VideoFiles: s.VideoFiles, NonVideo: s.NonVideo, AudioFiles: s.AudioFiles, UnknownFileCount: s.UnknownFileCount}
 		splunkstats := SplunkStats{Event: "metric", Time: t, Fields: &splunkfields}
 		go func(splunkstats SplunkStats) {
 			client := &http.Client{}
@@ -298,23 +409,4 @@ func (s *Stats) Write(field string, count uint64) {
 			}
 		}(splunkstats)
 	}
-	// Update stats DB
-	err := s.DB.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("Checkrr-stats"))
-		json, er := json.Marshal(s)
-		if er != nil {
-			return er
-		}
-		err := b.Put([]byte("current-stats"), json)
-		return err
-	})
-	if err != nil {
-		message := s.Localizer.MustLocalize(&i18n.LocalizeConfig{
-			MessageID: "DBFailure",
-			TemplateData: map[string]interface{}{
-				"Error": err.Error(),
-			},
-		})
-		s.Log.WithFields(log.Fields{"Module": "Stats", "DB Update": "Failure"}).Warn(message)
-	}
 }
@@ -12,7 +12,9 @@ import (
 	"os/exec"
 	"os/signal"
 	"runtime"
+	"slices"
 	"syscall"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/aetaric/checkrr/logging"
@@ -41,6 +43,8 @@ var cfgFile string
 var checkVer bool
 var oneShot bool
 var debug bool
+var dryRun bool
+var resume bool
 
 var web webserver.Webserver
 var DB *bolt.DB
@@ -101,7 +105,10 @@ func main() {
 	logger.Localizer = localizer
 	logger.FromConfig(k.Cut("logs"), k.Bool("checkrr.debug"))
 
-	if !k.Bool("checkrr.ffprobe") && !k.Bool("checkrr.ffmpeg-full") && !k.Bool("checkrr.ffmpeg-quick") {
+	// an explicit list of check stages takes over from the ffprobe and ffmpeg flags
+	checks := k.Strings("checkrr.checks")
+
+	if !k.Bool("checkrr.ffprobe") && !k.Bool("checkrr.ffmpeg-full") && !k.Bool("checkrr.ffmpeg-quick") && len(checks) == 0 {
 		message := localizer.MustLocalize(&i18n.LocalizeConfig{
 			MessageID: "NoChecks",
 		})
@@ -110,7 +117,7 @@ func main() {
 	}
 
 	// Verify ffprobe/ffmepg is in PATH
-	if k.Bool("checkrr.ffprobe") {
+	if k.Bool("checkrr.ffprobe") || slices.Contains(checks, "ffprobe") {
 		_, binpatherr := exec.LookPath("ffprobe")
 		if binpatherr != nil {
 			message := localizer.MustLocalize(&i18n.LocalizeConfig{
@@ -120,7 +127,7 @@ func main() {
 		}
 	}
 
-	if k.Bool("checkrr.ffmpeg-quick") || k.Bool("checkrr.ffmpeg-full") {
+	if k.Bool("checkrr.ffmpeg-quick") || k.Bool("checkrr.ffmpeg-full") || slices.Contains(checks, "ffmpeg-quick") || slices.Contains(checks, "ffmpeg-full") || k.Bool("checkrr.deepscan.enabled") {
 		_, binpatherr := exec.LookPath("ffmpeg")
 		if binpatherr != nil {
 			message := localizer.MustLocalize(&i18n.LocalizeConfig{
@@ -237,6 +244,57 @@ func main() {
 			logger.WithFields(log.Fields{"startup": true, "database": "setup"}).Fatal(message)
 		}
 
+		err = DB.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte("Checkrr-quarantine"))
+			if err != nil {
+				return fmt.Errorf("create bucket: %s", err)
+			}
+			return nil
+		})
+		if err != nil {
+			message := localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "DBSetupError",
+				TemplateData: map[string]interface{}{
+					"Error": err,
+				},
+			})
+			logger.WithFields(log.Fields{"startup": true, "database": "setup"}).Fatal(message)
+		}
+
+		err = DB.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte("Checkrr-suspect"))
+			if err != nil {
+				return fmt.Errorf("create bucket: %s", err)
+			}
+			return nil
+		})
+		if err != nil {
+			message := localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "DBSetupError",
+				TemplateData: map[string]interface{}{
+					"Error": err,
+				},
+			})
+			logger.WithFields(log.Fields{"startup": true, "database": "setup"}).Fatal(message)
+		}
+
+		err = DB.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte("Checkrr-checkpoint"))
+			if err != nil {
+				return fmt.Errorf("create bucket: %s", err)
+			}
+			return nil
+		})
+		if err != nil {
+			message := localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "DBSetupError",
+				TemplateData: map[string]interface{}{
+					"Error": err,
+				},
+			})
+			logger.WithFields(log.Fields{"startup": true, "database": "setup"}).Fatal(message)
+		}
+
 		testRunning := false
 		statsCleanup := features.Stats{}
 
@@ -306,6 +364,9 @@ func main() {
 	// Build checkrr from config
 	c := check.Checkrr{Chan: &rendertime, DB: DB, Logger: logger, FullConfig: k, Localizer: localizer}
 	c.FromConfig(k.Cut("checkrr"))
+	// A checkpoint is only left behind by an interrupted run. The daemon always picks it back up, one-off runs only
+	// when asked to.
+	c.Resume = (resume || !oneShot) && c.HasCheckpoint()
 
 	// Webserver Init
 	var runWeb bool = false
@@ -319,21 +380,36 @@ func main() {
 		if runWeb {
 			go web.Run()
 		}
+		go func() {
+			<-term
+			c.Shutdown()
+			os.Exit(0)
+		}()
 		c.Run()
 	} else {
-		// Setup Cron runner.
-		var id cron.EntryID
+		// Setup Cron runner. Checkpaths with their own cron get their own job.
 		scheduler = cron.New()
-		id, _ = scheduler.AddJob(k.String("checkrr.cron"), &c)
-		web.AddScheduler(scheduler, id)
+		ids := scheduleRuns(&c)
+		web.AddScheduler(scheduler)
 		if runWeb {
 			go web.Run()
 		}
 		scheduler.Start()
+
+		if c.Resume {
+			go c.Run()
+		}
+
+		// Watch mode runs alongside the schedule
+		stopWatch := make(chan struct{})
+		if k.Bool("checkrr.watch") {
+			go c.Watch(stopWatch)
+		}
+
 		message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
 			MessageID: "ScheduleNextRun",
 			TemplateData: map[string]interface{}{
-				"Time": scheduler.Entry(id).Next.String(),
+				"Time": nextRun().String(),
 			},
 		})
 		logger.Info(message)
@@ -343,27 +419,29 @@ func main() {
 			select {
 			case <-term:
 				// Shutdown process on SIGINT or SIGTERM
-				if c.Stats.Running {
-					c.Stats.Stop()
-					c.Stats.Render()
-				}
+				// Let a running check wrap up so it is recorded and can be resumed
+				close(stopWatch)
 				scheduler.Stop()
+				c.Shutdown()
 				os.Exit(0)
 			case <-rendertime:
 				// Output next run time
 				message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
 					MessageID: "ScheduleNextRun",
 					TemplateData: map[string]interface{}{
-						"Time": scheduler.Entry(id).Next.String(),
+						"Time": nextRun().String(),
 					},
 				})
 				logger.Info(message)
 			case <-hup:
 				// Reload config and reinit scheduler on SIGHUP
 				initConfig()
-				scheduler.Remove(id)
+				c.Reload(k.Cut("checkrr"))
+				for _, id := range ids {
+					scheduler.Remove(id)
+				}
 				scheduler.Stop()
-				id, _ = scheduler.AddJob(k.String("checkrr.cron"), &c)
+				ids = scheduleRuns(&c)
 				scheduler.Start()
 				message := c.Localizer.MustLocalize(&i18n.LocalizeConfig{
 					MessageID: "ConfigReload",
@@ -372,7 +450,7 @@ func main() {
 				message = c.Localizer.MustLocalize(&i18n.LocalizeConfig{
 					MessageID: "ScheduleNextRun",
 					TemplateData: map[string]interface{}{
-						"Time": scheduler.Entry(id).Next.String(),
+						"Time": nextRun().String(),
 					},
 				})
 				logger.Info(message)
@@ -381,6 +459,38 @@ func main() {
 	}
 }
 
+// scheduleRuns adds a cron job for each distinct schedule across the top level cron and the checkpaths
+func scheduleRuns(c *check.Checkrr) []cron.EntryID {
+	var ids []cron.EntryID
+	for _, spec := range c.Crons() {
+		id, err := scheduler.AddJob(spec, c.Schedule(spec))
+		if err != nil {
+			message := localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID: "ScheduleInvalidCron",
+				TemplateData: map[string]interface{}{
+					"Cron":  spec,
+					"Error": err.Error(),
+				},
+			})
+			logger.WithFields(log.Fields{"startup": true}).Error(message)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// nextRun is the soonest time any scheduled job runs
+func nextRun() time.Time {
+	var next time.Time
+	for _, entry := range scheduler.Entries() {
+		if next.IsZero() || (!entry.Next.IsZero() && entry.Next.Before(next)) {
+			next = entry.Next
+		}
+	}
+	return next
+}
+
 func printVersion() {
 	fmt.Printf("Checkrr version %s\n Commit: %s\n Built On: %s\n Built By: %s\n", version, commit, date, builtBy)
 }
@@ -391,6 +501,8 @@ func initFlags() {
 	flagSet.BoolVarP(&checkVer, "version", "v", false, "Prints version info")
 	flagSet.BoolVarP(&oneShot, "run-once", "o", false, "Runs Checkrr once and then exits; Default is running as a daemon")
 	flagSet.BoolVarP(&debug, "debug", "d", false, "Enables debug logging")
+	flagSet.BoolVar(&resume, "resume", false, "With --run-once, continues an interrupted run from where it left off instead of starting over")
+	flagSet.BoolVar(&dryRun, "dry-run", false, "Runs every check and records the results without removing or reacquiring anything")
 
 	flagSet.StringVarP(&cfgFile, "config-file", "c", "", "Specify a config file to use")
 
@@ -401,6 +513,12 @@ func initFlags() {
 }
 
 func initConfig() {
+	defer func() {
+		if dryRun {
+			k.Set("checkrr.dryrun", true)
+		}
+	}()
+
 	if cfgFile != "" {
 		if err := k.Load(file.Provider(cfgFile), yaml.Parser()); err != nil {
 			logger.LastResort.Fatalf("Error loading config file: %s\n %s", cfgFile, err)
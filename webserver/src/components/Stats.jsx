@@ -50,7 +50,7 @@ export default function Stats() {
     http.get('./api/stats/historical')
     .then(data => {
       // Fix the data so it's ready for chart.js
-      let sortedData = { sonarrSubmissions: [], radarrSubmissions: [], lidarrSubmissions: [], filesChecked: [], hashMatches: [],
+      let sortedData = { sonarrSubmissions: [], radarrSubmissions: [], lidarrSubmissions: [], readarrSubmissions: [], filesChecked: [], hashMatches: [],
           hashMismatches: [], videoFiles: [], audioFiles: [], unknownFileCount: [], nonVideo: [] }
       let label = []
       for (var obj in data) {
@@ -67,6 +67,9 @@ export default function Stats() {
                   case "lidarSubmissions":
                       sortedData.lidarrSubmissions.push(d[k])
                       break;
+                  case "readarrSubmissions":
+                      sortedData.readarrSubmissions.push(d[k])
+                      break;
                   case "filesChecked":
                       sortedData.filesChecked.push(d[k])
                       break;
@@ -29,7 +29,6 @@ var baseurl BaseURL
 
 var db *bolt.DB
 var scheduler *cron.Cron
-var cronEntry cron.EntryID
 var checkrrInstance *check.Checkrr
 var checkrrLogger *logging.Log
 var localizer *i18n.Localizer
@@ -42,6 +41,8 @@ type Webserver struct {
 	key            string
 	data           chan []string
 	trustedProxies []string
+	webhookUser    string
+	webhookPass    string
 	DB             *bolt.DB
 	config         *koanf.Koanf
 	FullConfig     *koanf.Koanf
@@ -77,6 +78,8 @@ func (w *Webserver) FromConfig(conf *koanf.Koanf, c chan []string, checkrr *chec
 	} else {
 		w.trustedProxies = nil
 	}
+	w.webhookUser = conf.String("webhook.username")
+	w.webhookPass = conf.String("webhook.password")
 	w.data = c
 	db = w.DB
 	checkrrInstance = checkrr
@@ -85,9 +88,8 @@ func (w *Webserver) FromConfig(conf *koanf.Koanf, c chan []string, checkrr *chec
 	localizer = l
 }
 
-func (w *Webserver) AddScheduler(cron *cron.Cron, entryid cron.EntryID) {
+func (w *Webserver) AddScheduler(cron *cron.Cron) {
 	scheduler = cron
-	cronEntry = entryid
 }
 
 func (w *Webserver) Run() {
@@ -131,10 +133,27 @@ func createServer(w *Webserver) *gin.Engine {
 	api := router.Group(w.BaseURL.String() + "api")
 	api.GET("/files/bad", getBadFiles)
 	api.POST("/files/bad", deleteBadFiles)
+	api.GET("/files/quarantine", getQuarantinedFiles)
+	api.POST("/files/quarantine/restore", restoreQuarantinedFiles)
+	api.POST("/files/quarantine/purge", purgeQuarantinedFiles)
 	api.GET("/stats/current", getCurrentStats)
 	api.GET("/stats/historical", getHistoricalStats)
 	api.GET("/schedule", getSchedule)
 	api.POST("/run", runCheckrr)
+	api.POST("/run/stop", stopCheckrr)
+
+	// arr webhooks can't send an api key, but they can do basic auth. Without it anyone could queue checks, so the
+	// route isn't mounted at all.
+	if w.webhookUser != "" && w.webhookPass != "" {
+		webhook := api.Group("/webhook")
+		webhook.Use(gin.BasicAuth(gin.Accounts{w.webhookUser: w.webhookPass}))
+		webhook.POST("/:arr", arrWebhook)
+	} else {
+		message := localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "WebWebhookNoAuth",
+		})
+		checkrrLogger.Info(message)
+	}
 
 	if w.tls {
 		message := localizer.MustLocalize(&i18n.LocalizeConfig{
@@ -253,6 +272,58 @@ func deleteBadFiles(ctx *gin.Context) {
 	ctx.JSON(200, files)
 }
 
+func getQuarantinedFiles(ctx *gin.Context) {
+	files, err := checkrrInstance.QuarantinedFiles()
+	if err != nil {
+		message := localizer.MustLocalize(&i18n.LocalizeConfig{
+			MessageID: "DBAccessFail",
+			TemplateData: map[string]interface{}{
+				"Error": err.Error(),
+			},
+		})
+		checkrrLogger.Fatal(message)
+	}
+	ctx.JSON(200, files)
+}
+
+// restoreQuarantinedFiles takes a list of original file paths and moves them back into the library
+func restoreQuarantinedFiles(ctx *gin.Context) {
+	var postData []string
+	err := ctx.BindJSON(&postData)
+	if err != nil {
+		return
+	}
+
+	failed := map[string]string{}
+	for _, path := range postData {
+		err := checkrrInstance.RestoreQuarantined(path)
+		if err != nil {
+			checkrrLogger.Warn(err.Error())
+			failed[path] = err.Error()
+		}
+	}
+	ctx.JSON(200, failed)
+}
+
+// purgeQuarantinedFiles takes a list of original file paths and deletes their quarantined copies
+func purgeQuarantinedFiles(ctx *gin.Context) {
+	var postData []string
+	err := ctx.BindJSON(&postData)
+	if err != nil {
+		return
+	}
+
+	failed := map[string]string{}
+	for _, path := range postData {
+		err := checkrrInstance.PurgeQuarantined(path)
+		if err != nil {
+			checkrrLogger.Warn(err.Error())
+			failed[path] = err.Error()
+		}
+	}
+	ctx.JSON(200, failed)
+}
+
 func getCurrentStats(ctx *gin.Context) {
 	var stats *Stats
 	err := db.View(func(tx *bolt.Tx) error {
@@ -315,8 +386,14 @@ func getHistoricalStats(ctx *gin.Context) {
 
 func getSchedule(ctx *gin.Context) {
 	if scheduler != nil {
-		nextRun := scheduler.Entry(cronEntry).Next.UTC().String()
-		ctx.JSON(200, nextRun)
+		// checkpaths can have their own cron, show whichever job runs first
+		var nextRun time.Time
+		for _, entry := range scheduler.Entries() {
+			if nextRun.IsZero() || (!entry.Next.IsZero() && entry.Next.Before(nextRun)) {
+				nextRun = entry.Next
+			}
+		}
+		ctx.JSON(200, nextRun.UTC().String())
 	} else {
 		ctx.JSON(200, nil)
 	}
@@ -327,6 +404,45 @@ func runCheckrr(ctx *gin.Context) {
 	ctx.JSON(200, nil)
 }
 
+// stopCheckrr cancels the current run, returning whether there was one to stop
+func stopCheckrr(ctx *gin.Context) {
+	ctx.JSON(200, checkrrInstance.Stop())
+}
+
+// arrWebhook takes the On Import and On Upgrade webhooks from sonarr, radarr, lidarr and readarr and checks the imported
+// files right away. The arr param is the name of the connection under arr in the config, for its path mappings.
+func arrWebhook(ctx *gin.Context) {
+	var payload webhookPayload
+	err := ctx.BindJSON(&payload)
+	if err != nil {
+		return
+	}
+
+	// the test button and other events have nothing for us to check
+	if payload.EventType != "Download" {
+		ctx.JSON(200, nil)
+		return
+	}
+
+	var paths []string
+	for _, file := range append(append(payload.EpisodeFiles, payload.TrackFiles...), payload.BookFiles...) {
+		paths = append(paths, file.Path)
+	}
+	for _, file := range []*webhookFile{payload.EpisodeFile, payload.MovieFile} {
+		if file != nil {
+			paths = append(paths, file.Path)
+		}
+	}
+
+	queued, err := checkrrInstance.QueueImport(ctx.Param("arr"), paths)
+	if err != nil {
+		checkrrLogger.Warn(err.Error())
+		ctx.JSON(404, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(200, queued)
+}
+
 // file system code
 type staticFileSystem struct {
 	http.FileSystem
@@ -373,22 +489,39 @@ type statData struct {
 	Data      *Stats
 }
 
+// webhookPayload is the part of the arr webhook body we care about. Sonarr sends episodeFile (or episodeFiles for
+// season packs), radarr sends movieFile, lidarr sends trackFiles and readarr sends bookFiles.
+type webhookPayload struct {
+	EventType    string        `json:"eventType"`
+	EpisodeFile  *webhookFile  `json:"episodeFile"`
+	EpisodeFiles []webhookFile `json:"episodeFiles"`
+	MovieFile    *webhookFile  `json:"movieFile"`
+	TrackFiles   []webhookFile `json:"trackFiles"`
+	BookFiles    []webhookFile `json:"bookFiles"`
+}
+
+type webhookFile struct {
+	Path string `json:"path"`
+}
+
 type badFileData struct {
 	Path string
 	Data *check.BadFile
 }
 
 type Stats struct {
-	SonarrSubmissions uint64        `json:"sonarrSubmissions"`
-	RadarrSubmissions uint64        `json:"radarrSubmissions"`
-	LidarrSubmissions uint64        `json:"lidarrSubmissions"`
-	FilesChecked      uint64        `json:"filesChecked"`
-	HashMatches       uint64        `json:"hashMatches"`
-	HashMismatches    uint64        `json:"hashMismatches"`
-	VideoFiles        uint64        `json:"videoFiles"`
-	AudioFiles        uint64        `json:"audioFiles"`
-	UnknownFileCount  uint64        `json:"unknownFileCount"`
-	NonVideo          uint64        `json:"nonVideo"`
-	Running           bool          `json:"running"`
-	Diff              time.Duration `json:"timeDiff"`
+	SonarrSubmissions  uint64        `json:"sonarrSubmissions"`
+	RadarrSubmissions  uint64        `json:"radarrSubmissions"`
+	LidarrSubmissions  uint64        `json:"lidarrSubmissions"`
+	ReadarrSubmissions uint64        `json:"readarrSubmissions"`
+	FilesChecked       uint64        `json:"filesChecked"`
+	HashMatches        uint64        `json:"hashMatches"`
+	HashMismatches     uint64        `json:"hashMismatches"`
+	VideoFiles         uint64        `json:"videoFiles"`
+	AudioFiles         uint64        `json:"audioFiles"`
+	UnknownFileCount   uint64        `json:"unknownFileCount"`
+	NonVideo           uint64        `json:"nonVideo"`
+	Running            bool          `json:"running"`
+	Cancelled          bool          `json:"cancelled"`
+	Diff               time.Duration `json:"timeDiff"`
 }